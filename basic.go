@@ -1,122 +1,610 @@
 package lsh
 
 import (
+	"cmp"
 	"fmt"
+	"io"
+	"slices"
 	"sync"
 )
 
-type basicHashTableKey string
+// basicHashTableKey is the 64-bit fingerprint of a hashTableKey, which
+// keys the hash tables.
+type basicHashTableKey uint64
 
-type hashTable map[basicHashTableKey]hashTableBucket
+// fingerprint returns the 64-bit fingerprint of key.
+func (key hashTableKey) fingerprint() basicHashTableKey {
+	h := uint64(len(key))
+	for _, hashVal := range key {
+		h = permute(uint64(hashVal), h)
+	}
+	return basicHashTableKey(h)
+}
 
-// BasicLsh implements the original LSH algorithm for L2 distance.
-type BasicLsh struct {
-	*lshParams
+// hashTableEntry is the bucket of a key in a hash table, chained with
+// the entries of the other keys sharing its fingerprint.
+type hashTableEntry[K ID] struct {
+	key  hashTableKey
+	ids  hashTableBucket[K]
+	next *hashTableEntry[K]
+}
+
+type hashTable[K ID] map[basicHashTableKey]*hashTableEntry[K]
+
+// get returns the entry of key, or nil if its bucket is empty.
+func (table hashTable[K]) get(key hashTableKey) *hashTableEntry[K] {
+	for entry := table[key.fingerprint()]; entry != nil; entry = entry.next {
+		if slices.Equal(entry.key, key) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// add appends id to the bucket of key.
+func (table hashTable[K]) add(key hashTableKey, id K) {
+	fp := key.fingerprint()
+	for entry := table[fp]; entry != nil; entry = entry.next {
+		if slices.Equal(entry.key, key) {
+			entry.ids = append(entry.ids, id)
+			return
+		}
+	}
+	table[fp] = &hashTableEntry[K]{
+		key:  key,
+		ids:  hashTableBucket[K]{id},
+		next: table[fp],
+	}
+}
+
+// remove removes one occurrence of id from the first bucket holding it
+// among the keys with fingerprint fp, and the entry of that bucket if
+// it is left empty.
+func (table hashTable[K]) remove(fp basicHashTableKey, id K) {
+	var prev *hashTableEntry[K]
+	for entry := table[fp]; entry != nil; prev, entry = entry, entry.next {
+		i := slices.Index(entry.ids, id)
+		if i < 0 {
+			continue
+		}
+		entry.ids = remove(entry.ids, i)
+		if len(entry.ids) > 0 {
+			return
+		}
+		switch {
+		case prev != nil:
+			prev.next = entry.next
+		case entry.next != nil:
+			table[fp] = entry.next
+		default:
+			delete(table, fp)
+		}
+		return
+	}
+}
+
+// sorted returns the entries of the table sorted by fingerprint and
+// key, with their fingerprints.
+func (table hashTable[K]) sorted() ([]*hashTableEntry[K], []basicHashTableKey) {
+	type fpEntry struct {
+		fp    basicHashTableKey
+		entry *hashTableEntry[K]
+	}
+	all := make([]fpEntry, 0, len(table))
+	for fp, entry := range table {
+		for ; entry != nil; entry = entry.next {
+			all = append(all, fpEntry{fp, entry})
+		}
+	}
+	slices.SortFunc(all, func(a, b fpEntry) int {
+		return cmp.Or(cmp.Compare(a.fp, b.fp), slices.Compare(a.entry.key, b.entry.key))
+	})
+	entries := make([]*hashTableEntry[K], len(all))
+	fps := make([]basicHashTableKey, len(all))
+	for i := range all {
+		entries[i], fps[i] = all[i].entry, all[i].fp
+	}
+	return entries, fps
+}
+
+// BasicIndexOf implements the original LSH algorithm for inputs of
+// type P identified by ids of type K, using a family of hash
+// functions over P.
+// It is safe for concurrent use by multiple goroutines.
+type BasicIndexOf[P any, K ID] struct {
+	// Family of hash functions.
+	family Family[P]
 	// Hash tables.
-	tables []hashTable
+	tables []hashTable[K]
+	// Locks guarding each hash table.
+	tableLocks []sync.RWMutex
+	// Fingerprints of the keys of the buckets of each id, one per hash
+	// table for each insert of the id.
+	keys map[K][]basicHashTableKey
+	// Lock guarding keys.
+	keysLock sync.Mutex
+	// Inserted points, only kept for asymmetric families or if
+	// WithVectors is used.
+	points map[K]P
+	// Lock guarding points.
+	pointsLock sync.RWMutex
+	// How Insert handles ids already in the index.
+	duplicates DuplicatePolicy
+	// Lock held for reading by all operations, and for writing when
+	// an insert changes the keys of all points (asymmetric families)
+	// or must check for the id atomically (Upsert).
+	lock sync.RWMutex
 }
 
+// BasicIndex implements the original LSH algorithm for inputs of
+// type P identified by string ids.
+type BasicIndex[P any] = BasicIndexOf[P, string]
+
+// BasicLsh implements the original LSH algorithm for L2 distance.
+type BasicLsh = BasicIndex[Point]
+
 // NewBasicLsh creates a basic LSH for L2 distance.
 // dim is the diminsionality of the data, l is the number of hash
 // tables to use, m is the number of hash values to concatenate to
 // form the key to the hash tables, w is the slot size for the
 // family of LSH functions.
-func NewBasicLsh(dim, l, m int, w float64) *BasicLsh {
-	tables := make([]hashTable, l)
+// By default the LSH is for L2 distance, use WithMetric(L1) for L1.
+func NewBasicLsh(dim, l, m int, w float64, opts ...Option) *BasicLsh {
+	cfg := newConfig(opts)
+	return NewBasicLshWithFamily(newLshParams[float64](dim, l, m, w, cfg.metric, cfg.rand()), opts...)
+}
+
+// NewBasicLshFromParams creates a basic LSH like NewBasicLsh, but
+// validates the parameters and options first and returns an error
+// wrapping ErrInvalidParams if any is invalid.
+func NewBasicLshFromParams(params Params, opts ...Option) (*BasicLsh, error) {
+	family, err := newLshParamsFromParams(params, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewBasicLshWithFamily(family, opts...), nil
+}
+
+// NewBasicLshWithFamily creates a basic LSH using the given family
+// of hash functions.
+func NewBasicLshWithFamily[P any](family Family[P], opts ...Option) *BasicIndex[P] {
+	return NewBasicIndexOf[string](family, opts...)
+}
+
+// NewBasicIndexOf creates a basic LSH using the given family of hash
+// functions, for points identified by ids of type K, for example
+// NewBasicIndexOf[uint64](family).
+func NewBasicIndexOf[K ID, P any](family Family[P], opts ...Option) *BasicIndexOf[P, K] {
+	cfg := newConfig(opts)
+	// Asymmetric families adapt to the inserted points, so each index
+	// keeps its own copy.
+	if af, ok := family.(asymmetricFamily[P]); ok {
+		family = af.clone()
+	}
+	tables := make([]hashTable[K], family.NumTables())
 	for i := range tables {
-		tables[i] = make(hashTable)
+		tables[i] = make(hashTable[K])
+	}
+	index := &BasicIndexOf[P, K]{
+		family:     family,
+		tables:     tables,
+		tableLocks: make([]sync.RWMutex, len(tables)),
+		keys:       make(map[K][]basicHashTableKey),
+		duplicates: cfg.duplicates,
 	}
-	return &BasicLsh{
-		lshParams: newLshParams(dim, l, m, w),
-		tables:    tables,
+	if _, ok := family.(asymmetricFamily[P]); ok || cfg.vectors {
+		index.points = make(map[K]P)
 	}
+	return index
+}
+
+// Insert adds a new data point to the LSH.
+// id is the unique identifier for the data point, an id already in
+// the LSH is handled according to the DuplicatePolicy.
+// It panics if the dimensionality of point does not match, or if id
+// is rejected as a duplicate.
+func (index *BasicIndexOf[P, K]) Insert(point P, id K) {
+	if err := index.TryInsert(point, id); err != nil {
+		panic(err)
+	}
+}
+
+// TryInsert adds a new data point to the LSH like Insert, but returns
+// an error wrapping ErrDimensionMismatch or ErrDuplicateID instead of
+// panicking.
+func (index *BasicIndexOf[P, K]) TryInsert(point P, id K) error {
+	return index.tryInsert(point, id, index.duplicates)
+}
+
+// Upsert adds a new data point to the LSH, replacing atomically all
+// the existing entries for id, if any.
+// It returns an error wrapping ErrDimensionMismatch if the
+// dimensionality of point does not match.
+func (index *BasicIndexOf[P, K]) Upsert(point P, id K) error {
+	return index.tryInsert(point, id, ReplaceDuplicates)
 }
 
-func (index *BasicLsh) toBasicHashTableKeys(keys []hashTableKey) []basicHashTableKey {
-	basicKeys := make([]basicHashTableKey, index.l)
-	for i, key := range keys {
-		s := ""
-		for _, hashVal := range key {
-			s += fmt.Sprintf("%.16x", hashVal)
+func (index *BasicIndexOf[P, K]) tryInsert(point P, id K, duplicates DuplicatePolicy) error {
+	if err := checkDim(index.family, point); err != nil {
+		return err
+	}
+	family, asymmetric := index.family.(asymmetricFamily[P])
+	if asymmetric || duplicates != AllowDuplicates {
+		index.lock.Lock()
+		defer index.lock.Unlock()
+	} else {
+		index.lock.RLock()
+		defer index.lock.RUnlock()
+	}
+	if duplicates != AllowDuplicates {
+		if _, exist := index.keys[id]; exist {
+			if duplicates == RejectDuplicates {
+				return fmt.Errorf("%w: %v", ErrDuplicateID, id)
+			}
+			index.delete(id)
 		}
-		basicKeys[i] = basicHashTableKey(s)
 	}
-	return basicKeys
+	if asymmetric && family.fit(point) {
+		index.rehash()
+	}
+	if index.points != nil {
+		index.pointsLock.Lock()
+		index.points[id] = point
+		index.pointsLock.Unlock()
+	}
+	index.insert([][]hashTableKey{hashKeys(index.family, point)}, []K{id})
+	return nil
 }
 
-// Insert adds a new data point to the LSH.
-// id is the unique identifier for the data point.
-func (index *BasicLsh) Insert(point Point, id string) {
-	// Apply hash functions
-	hvs := index.toBasicHashTableKeys(index.hash(point))
-	// Insert key into all hash tables
+// InsertBatch adds the data points to the LSH, where ids[i] is the
+// unique identifier for points[i]. The points are hashed together,
+// which is faster than inserting them one at a time for families
+// implementing BatchFamily.
+// It returns an error wrapping ErrDimensionMismatch before inserting
+// any point if the dimensionality of a point does not match. Ids
+// already in the LSH are handled according to the DuplicatePolicy,
+// and an error wrapping ErrDuplicateID stops the insertion.
+func (index *BasicIndexOf[P, K]) InsertBatch(points []P, ids []K) error {
+	if err := checkBatch(index.family, points, ids); err != nil {
+		return err
+	}
+	if _, ok := index.family.(asymmetricFamily[P]); ok || index.duplicates != AllowDuplicates {
+		for i := range points {
+			if err := index.TryInsert(points[i], ids[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	keys := batchKeys(index.family, points)
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	if index.points != nil {
+		index.pointsLock.Lock()
+		for i, id := range ids {
+			index.points[id] = points[i]
+		}
+		index.pointsLock.Unlock()
+	}
+	index.insert(keys, ids)
+	return nil
+}
+
+// rehash rebuilds the hash tables from the inserted points.
+// The lock must be held for writing.
+func (index *BasicIndexOf[P, K]) rehash() {
+	for i := range index.tables {
+		index.tables[i] = make(hashTable[K])
+	}
+	clear(index.keys)
+	ids := make([]K, 0, len(index.points))
+	points := make([]P, 0, len(index.points))
+	for id, point := range index.points {
+		ids = append(ids, id)
+		points = append(points, point)
+	}
+	index.insert(batchKeys(index.family, points), ids)
+}
+
+// insert adds each ids[k] to the buckets of keys[k] in all tables.
+func (index *BasicIndexOf[P, K]) insert(keys [][]hashTableKey, ids []K) {
+	// Insert keys into all hash tables
 	var wg sync.WaitGroup
 	wg.Add(len(index.tables))
 	for i := range index.tables {
-		hv := hvs[i]
 		table := index.tables[i]
-		go func(table hashTable, hv basicHashTableKey) {
-			if _, exist := table[hv]; !exist {
-				table[hv] = make(hashTableBucket, 0)
+		tableLock := &index.tableLocks[i]
+		go func(i int, table hashTable[K]) {
+			tableLock.Lock()
+			for k, id := range ids {
+				table.add(keys[k][i], id)
 			}
-			table[hv] = append(table[hv], id)
+			tableLock.Unlock()
 			wg.Done()
-		}(table, hv)
+		}(i, table)
 	}
 	wg.Wait()
+	// Record the keys after the ids are in all buckets, so Delete
+	// always finds the ids in the buckets of the recorded keys.
+	index.keysLock.Lock()
+	for k, id := range ids {
+		fps := slices.Grow(index.keys[id], len(keys[k]))
+		for _, key := range keys[k] {
+			fps = append(fps, key.fingerprint())
+		}
+		index.keys[id] = fps
+	}
+	index.keysLock.Unlock()
 }
 
 // Query finds the ids of approximate nearest neighbour candidates,
-// in un-sorted order, given the query point,
-func (index *BasicLsh) Query(q Point) []string {
+// in un-sorted order, given the query point.
+// It panics if the dimensionality of q does not match.
+func (index *BasicIndexOf[P, K]) Query(q P) []K {
+	ids, err := index.TryQuery(q)
+	if err != nil {
+		panic(err)
+	}
+	return ids
+}
+
+// TryQuery finds the candidates like Query, but returns an error
+// wrapping ErrDimensionMismatch instead of panicking.
+func (index *BasicIndexOf[P, K]) TryQuery(q P) ([]K, error) {
+	if err := checkDim(index.family, q); err != nil {
+		return nil, err
+	}
+	index.lock.RLock()
+	defer index.lock.RUnlock()
 	// Apply hash functions
-	hvs := index.toBasicHashTableKeys(index.hash(q))
+	return index.lookup(queryKeys(index.family, q)), nil
+}
+
+// QueryBatch finds the candidates of each query point like Query,
+// hashing all the query points together.
+// It returns an error wrapping ErrDimensionMismatch if the
+// dimensionality of a query point does not match.
+func (index *BasicIndexOf[P, K]) QueryBatch(queries []P) ([][]K, error) {
+	if err := checkBatch[P, K](index.family, queries, nil); err != nil {
+		return nil, err
+	}
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	results := make([][]K, len(queries))
+	for i, hvs := range batchQueryKeys(index.family, queries) {
+		results[i] = index.lookup(hvs)
+	}
+	return results, nil
+}
+
+// lookup returns the ids in the buckets of the keys hvs in all tables.
+// The lock must be held.
+func (index *BasicIndexOf[P, K]) lookup(hvs []hashTableKey) []K {
 	// Keep track of keys seen
-	seen := make(map[string]bool)
+	seen := make(map[K]bool)
 	for i, table := range index.tables {
-		if candidates, exist := table[hvs[i]]; exist {
-			for _, id := range candidates {
+		index.tableLocks[i].RLock()
+		if entry := table.get(hvs[i]); entry != nil {
+			for _, id := range entry.ids {
 				if _, exist := seen[id]; exist {
 					continue
 				}
 				seen[id] = true
 			}
 		}
+		index.tableLocks[i].RUnlock()
 	}
 	// Collect results
-	ids := make([]string, 0, len(seen))
+	ids := make([]K, 0, len(seen))
 	for id := range seen {
 		ids = append(ids, id)
 	}
 	return ids
 }
 
-// Delete removes a new data point to the LSH.
+// QueryKNN finds the k nearest neighbours among the candidates
+// returned by Query, sorted by ascending exact distance to the query
+// point. The index must store vectors (see WithVectors).
+// It panics if the dimensionality of q does not match or if the index
+// does not store vectors.
+func (index *BasicIndexOf[P, K]) QueryKNN(q P, k int) []NeighborOf[K] {
+	neighbors, err := index.TryQueryKNN(q, k)
+	if err != nil {
+		panic(err)
+	}
+	return neighbors
+}
+
+// TryQueryKNN finds the k nearest neighbours like QueryKNN, but
+// returns an error wrapping ErrDimensionMismatch or ErrNoVectors
+// instead of panicking.
+func (index *BasicIndexOf[P, K]) TryQueryKNN(q P, k int) ([]NeighborOf[K], error) {
+	if err := checkVectors(index.family, index.points); err != nil {
+		return nil, err
+	}
+	candidates, err := index.TryQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	index.pointsLock.RLock()
+	defer index.pointsLock.RUnlock()
+	return rankNeighbors(index.family, index.points, q, candidates, k), nil
+}
+
+// QueryRadius finds the candidates returned by Query within distance
+// r of the query point, sorted by ascending exact distance.
+// The index must store vectors (see WithVectors).
+// It panics if the dimensionality of q does not match or if the index
+// does not store vectors.
+func (index *BasicIndexOf[P, K]) QueryRadius(q P, r float64) []NeighborOf[K] {
+	neighbors, err := index.TryQueryRadius(q, r)
+	if err != nil {
+		panic(err)
+	}
+	return neighbors
+}
+
+// TryQueryRadius finds the candidates within distance r like
+// QueryRadius, but returns an error wrapping ErrDimensionMismatch or
+// ErrNoVectors instead of panicking.
+func (index *BasicIndexOf[P, K]) TryQueryRadius(q P, r float64) ([]NeighborOf[K], error) {
+	if err := checkVectors(index.family, index.points); err != nil {
+		return nil, err
+	}
+	candidates, err := index.TryQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	index.pointsLock.RLock()
+	defer index.pointsLock.RUnlock()
+	return radiusNeighbors(index.family, index.points, q, candidates, r), nil
+}
+
+// Delete removes a data point from the LSH, including all the
+// times it was inserted. It only visits the buckets the point was
+// inserted into.
 // id is the unique identifier for the data point.
-func (index *BasicLsh) Delete(id string) {
-	// Delete key from all hash tables
+// It returns an error wrapping ErrNotFound if id is not in the LSH.
+func (index *BasicIndexOf[P, K]) Delete(id K) error {
+	// Inserts of the same id only hold the lock for reading, so
+	// deleting excludes them to not leave the id partly inserted.
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	if !index.delete(id) {
+		return fmt.Errorf("%w: %v", ErrNotFound, id)
+	}
+	return nil
+}
+
+// delete removes id from the LSH, and returns whether it was found.
+// The lock must be held for writing.
+func (index *BasicIndexOf[P, K]) delete(id K) bool {
+	index.keysLock.Lock()
+	fps, exist := index.keys[id]
+	delete(index.keys, id)
+	index.keysLock.Unlock()
+	if !exist {
+		return false
+	}
+	index.pointsLock.Lock()
+	delete(index.points, id)
+	index.pointsLock.Unlock()
+	// Delete id from its bucket in all hash tables
 	var wg sync.WaitGroup
 	wg.Add(len(index.tables))
 	for i := range index.tables {
 		table := index.tables[i]
-		go func(table hashTable) {
-			for tableIndex, bucket := range table {
-				for index, identifier := range bucket {
-					if id == identifier {
-						table[tableIndex] = remove(bucket, index)
-						if len(table[tableIndex]) == 0 {
-							delete(table, tableIndex)
-						}
-					}
-				}
+		tableLock := &index.tableLocks[i]
+		go func(i int, table hashTable[K]) {
+			tableLock.Lock()
+			for j := i; j < len(fps); j += len(index.tables) {
+				table.remove(fps[j], id)
 			}
+			tableLock.Unlock()
 			wg.Done()
-		}(table)
+		}(i, table)
 	}
 	wg.Wait()
+	return true
+}
+
+// WriteTo writes the LSH to w in a versioned and checksummed binary
+// format, including the hash functions and the stored vectors, and
+// returns the number of bytes written. It implements io.WriterTo.
+// Only the families of hash functions of this package and points of
+// type Point, BinaryPoint or []uint64 can be written.
+func (index *BasicIndexOf[P, K]) WriteTo(w io.Writer) (int64, error) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	enc := newEncoder(w, kindBasic, idKind[K]())
+	index.encode(enc)
+	return enc.finish()
+}
+
+// encode writes the contents of the LSH.
+// The lock must be held for writing.
+func (index *BasicIndexOf[P, K]) encode(enc *encoder) {
+	encodeFamily(enc, index.family)
+	enc.int(int(index.duplicates))
+	enc.int(len(index.tables))
+	for _, table := range index.tables {
+		entries, _ := table.sorted()
+		enc.int(len(entries))
+		for _, entry := range entries {
+			enc.ints(entry.key)
+			encodeIDs(enc, entry.ids)
+		}
+	}
+	encodePoints(enc, index.points)
+}
+
+// ReadFrom replaces the LSH with the one written by WriteTo to r, and
+// returns the number of bytes read. It implements io.ReaderFrom.
+// It returns an error wrapping ErrInvalidFormat if the data is
+// corrupt or was not written by a BasicIndex of the same type.
+// ReadFrom buffers reads from r unless r is a *bufio.Reader, and must
+// not be called concurrently with other methods.
+func (index *BasicIndexOf[P, K]) ReadFrom(r io.Reader) (int64, error) {
+	dec := newDecoder(r, kindBasic, idKind[K]())
+	loaded := decodeBasic[P, K](dec)
+	if n, err := dec.finish(); err != nil {
+		return n, err
+	}
+	index.family = loaded.family
+	index.tables = loaded.tables
+	index.tableLocks = loaded.tableLocks
+	index.keys = loaded.keys
+	index.points = loaded.points
+	index.duplicates = loaded.duplicates
+	return dec.n, nil
+}
+
+// decodeBasic reads the contents of a LSH written by encode.
+func decodeBasic[P any, K ID](dec *decoder) *BasicIndexOf[P, K] {
+	family := decodeTypedFamily[P](dec)
+	if dec.err != nil {
+		return nil
+	}
+	index := NewBasicIndexOf[K](family)
+	index.duplicates = DuplicatePolicy(dec.int())
+	if dec.err == nil && (index.duplicates < AllowDuplicates || index.duplicates > ReplaceDuplicates) {
+		dec.fail("unknown duplicate policy %d", index.duplicates)
+	}
+	if l := dec.length(); dec.err == nil && l != len(index.tables) {
+		dec.fail("expected %d tables, found %d", len(index.tables), l)
+	}
+	m := family.NumHashes()
+	for _, table := range index.tables {
+		n := dec.length()
+		for j := 0; j < n && dec.err == nil; j++ {
+			key := hashTableKey(dec.ints())
+			ids := decodeIDs[K](dec)
+			if dec.err != nil {
+				break
+			}
+			if len(key) != m || len(ids) == 0 || table.get(key) != nil {
+				dec.fail("invalid bucket %v", key)
+				break
+			}
+			for _, id := range ids {
+				table.add(key, id)
+			}
+		}
+	}
+	index.keys = indexKeys(dec, len(index.tables), 1, func(i int, add func(K, []basicHashTableKey)) {
+		for fp, entry := range index.tables[i] {
+			for ; entry != nil; entry = entry.next {
+				for _, id := range entry.ids {
+					add(id, []basicHashTableKey{fp})
+				}
+			}
+		}
+	})
+	index.points = decodePoints[P, K](dec)
+	return index
 }
 
-func remove(original []string, index int) []string {
+func remove[K ID](original []K, index int) []K {
 	original[index] = original[len(original)-1]
 	original = original[:len(original)-1]
 	return original
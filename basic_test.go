@@ -1,6 +1,8 @@
 package lsh
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"testing"
 )
@@ -73,3 +75,236 @@ func Test_Delete(t *testing.T) {
 	}
 	Test_Insert(t)
 }
+
+func Test_NewBasicLshWithFamily(t *testing.T) {
+	lsh := NewBasicLshWithFamily(NewL2Family(100, 5, 5, 5.0))
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		found := false
+		for _, foundKey := range lsh.Query(p) {
+			if foundKey == strconv.Itoa(i) {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Query fail")
+		}
+	}
+}
+
+func Test_QueryKNN(t *testing.T) {
+	lsh := NewBasicLsh(100, 5, 5, 50.0, WithVectors())
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		checkNeighbors(t, lsh.QueryKNN(p, 3), p, points, strconv.Itoa(i), 3)
+	}
+	forest := NewLshForest(100, 5, 5, 50.0, WithVectors())
+	multiprobe := NewMultiprobeLsh(100, 5, 5, 50.0, 4, WithVectors())
+	for i, p := range points {
+		forest.Insert(p, strconv.Itoa(i))
+		multiprobe.Insert(p, strconv.Itoa(i))
+	}
+	for _, k := range []int{0, -1} {
+		if len(lsh.QueryKNN(points[0], k)) != 0 || len(forest.QueryKNN(points[0], k)) != 0 ||
+			len(multiprobe.QueryKNN(points[0], k)) != 0 {
+			t.Errorf("Expected no neighbours for k = %d", k)
+		}
+	}
+	if NewBasicLsh(100, 5, 5, 50.0).points != nil {
+		t.Error("Vectors should only be stored with WithVectors")
+	}
+}
+
+func Test_QueryRadius(t *testing.T) {
+	lsh := NewBasicLsh(100, 5, 5, 50.0, WithVectors())
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		checkRadius(t, lsh.QueryRadius(p, 130.0), p, points, strconv.Itoa(i), 130.0)
+	}
+}
+
+func Test_TryQueryKNN(t *testing.T) {
+	type neighborQuerier interface {
+		TryQueryKNN(q Point, k int) ([]Neighbor, error)
+		TryQueryRadius(q Point, r float64) ([]Neighbor, error)
+	}
+	q := randomPoints(1, 10, 1.0)[0]
+	for name, vectors := range map[string]bool{"vectors": true, "no vectors": false} {
+		var opts []Option
+		if vectors {
+			opts = append(opts, WithVectors())
+		}
+		for index, querier := range map[string]neighborQuerier{
+			"basic":      NewBasicLsh(10, 2, 2, 1.0, opts...),
+			"multiprobe": NewMultiprobeLsh(10, 2, 2, 1.0, 2, opts...),
+			"forest":     NewLshForest(10, 2, 2, 1.0, opts...),
+		} {
+			expected := ErrDimensionMismatch
+			if !vectors {
+				expected = ErrNoVectors
+			}
+			if _, err := querier.TryQueryKNN(q[:5], 1); !errors.Is(err, expected) {
+				t.Errorf("%s, %s: expected %v from TryQueryKNN, got %v", index, name, expected, err)
+			}
+			if _, err := querier.TryQueryRadius(q[:5], 1); !errors.Is(err, expected) {
+				t.Errorf("%s, %s: expected %v from TryQueryRadius, got %v", index, name, expected, err)
+			}
+			if _, err := querier.TryQueryKNN(q, 1); vectors && err != nil {
+				t.Errorf("%s: TryQueryKNN fail: %v", index, err)
+			}
+		}
+	}
+}
+
+func Test_DeleteReverseIndex(t *testing.T) {
+	lsh := NewBasicLsh(100, 5, 5, 5.0)
+	points := randomPoints(10, 100, 32.0)
+	// Share a bucket with another id, and insert an id twice.
+	lsh.Insert(points[0], "a")
+	lsh.Insert(points[0], "b")
+	lsh.Insert(points[0], "b")
+	lsh.Insert(points[1], "b")
+	if err := lsh.Delete("b"); err != nil {
+		t.Errorf("Delete fail: %v", err)
+	}
+	if len(lsh.keys) != 1 {
+		t.Errorf("Expected 1 id in the reverse index, found %d", len(lsh.keys))
+	}
+	for _, table := range lsh.tables {
+		if len(table) != 1 {
+			t.Errorf("Expected 1 bucket, found %d", len(table))
+		}
+		for _, entry := range table {
+			if len(entry.ids) != 1 || entry.ids[0] != "a" {
+				t.Errorf("Expected bucket [a], found %v", entry.ids)
+			}
+		}
+	}
+	if err := lsh.Delete("b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Deleting an unknown id should return ErrNotFound, got %v", err)
+	}
+}
+
+func Test_Upsert(t *testing.T) {
+	lsh := NewBasicLsh(100, 5, 5, 5.0, WithVectors())
+	points := randomPoints(2, 100, 32.0)
+	lsh.Insert(points[0], "a")
+	lsh.Insert(points[0], "a")
+	if err := lsh.Upsert(points[1], "a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(lsh.keys["a"]) != len(lsh.tables) {
+		t.Errorf("Expected 1 insert of a, found %d fingerprints", len(lsh.keys["a"]))
+	}
+	for i, table := range lsh.tables {
+		if len(table) != 1 {
+			t.Errorf("Expected 1 bucket in table %d, found %d", i, len(table))
+		}
+	}
+	if !contains(lsh.Query(points[1]), "a") {
+		t.Error("Upsert fail")
+	}
+	if lsh.points["a"][0] != points[1][0] {
+		t.Error("Upsert should replace the stored vector")
+	}
+}
+
+func Test_DuplicatePolicy(t *testing.T) {
+	p := randomPoints(1, 100, 32.0)[0]
+	reject := NewBasicLsh(100, 5, 5, 5.0, WithDuplicatePolicy(RejectDuplicates))
+	reject.Insert(p, "a")
+	if err := reject.TryInsert(p, "a"); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+	replace := NewBasicLsh(100, 5, 5, 5.0, WithDuplicatePolicy(ReplaceDuplicates))
+	replace.Insert(p, "a")
+	replace.Insert(p, "a")
+	for _, table := range replace.tables {
+		for _, entry := range table {
+			if len(entry.ids) != 1 {
+				t.Errorf("Expected bucket [a], found %v", entry.ids)
+			}
+		}
+	}
+	if _, err := NewBasicLshFromParams(Params{Dim: 100, L: 5, M: 5, W: 5.0},
+		WithDuplicatePolicy(DuplicatePolicy(7))); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("Expected ErrInvalidParams, got %v", err)
+	}
+}
+
+func Test_HashTableCollision(t *testing.T) {
+	table := make(hashTable[string])
+	a, b := hashTableKey{1, 2}, hashTableKey{3, 4}
+	// Chain a under the fingerprint of b, as if they collided.
+	table[b.fingerprint()] = &hashTableEntry[string]{key: a, ids: hashTableBucket[string]{"a"}}
+	table.add(b, "b")
+	if entry := table.get(b); entry == nil || len(entry.ids) != 1 || entry.ids[0] != "b" {
+		t.Errorf("Expected bucket [b], found %v", entry)
+	}
+	table.remove(b.fingerprint(), "b")
+	if entry := table[b.fingerprint()]; entry == nil || entry.ids[0] != "a" || entry.next != nil {
+		t.Error("Removing b should keep the colliding bucket")
+	}
+}
+
+// hexKey builds a key by concatenating the hex strings of the hash
+// values, as the hash tables were keyed before fingerprints.
+func hexKey(key hashTableKey) string {
+	s := ""
+	for _, hashVal := range key {
+		s += fmt.Sprintf("%.16x", hashVal)
+	}
+	return s
+}
+
+func Benchmark_HexKey(b *testing.B) {
+	keys := hashKeys(NewL2Family(100, 10, 10, 5.0), randomPoints(1, 100, 32.0)[0])
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			hexKey(key)
+		}
+	}
+}
+
+func Benchmark_Fingerprint(b *testing.B) {
+	keys := hashKeys(NewL2Family(100, 10, 10, 5.0), randomPoints(1, 100, 32.0)[0])
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			key.fingerprint()
+		}
+	}
+}
+
+func Benchmark_Insert(b *testing.B) {
+	points := randomPoints(1000, 100, 32.0)
+	lsh := NewBasicLsh(100, 10, 10, 5.0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lsh.Insert(points[i%len(points)], strconv.Itoa(i))
+	}
+}
+
+func Benchmark_Query(b *testing.B) {
+	points := randomPoints(1000, 100, 32.0)
+	lsh := NewBasicLsh(100, 10, 10, 5.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lsh.Query(points[i%len(points)])
+	}
+}
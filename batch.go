@@ -0,0 +1,187 @@
+package lsh
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// BatchFamily is implemented by families of hash functions that hash
+// many points at once faster than one at a time, such as the p-stable
+// families and NewCosineFamily. The indexes use it for InsertBatch
+// and QueryBatch.
+type BatchFamily[P any] interface {
+	Family[P]
+	// HashBatch returns the combined hash values of all the points for
+	// all the hash tables, indexed by point and then by table, which
+	// are the same as those returned by Hash.
+	HashBatch(points []P) [][][]int
+}
+
+// batchChunk is the number of points projected together by
+// projectBatch, which bounds the memory used for the projections.
+const batchChunk = 256
+
+// packVectors copies the vectors of a into a contiguous row-major
+// matrix, in the order of a, and makes the vectors of a slices of it.
+func packVectors[F Float](a [][]Vector[F], dim int) []F {
+	rows := 0
+	for i := range a {
+		rows += len(a[i])
+	}
+	matrix := make([]F, 0, rows*dim)
+	for i := range a {
+		for j := range a[i] {
+			start := len(matrix)
+			matrix = append(matrix, a[i][j]...)
+			a[i][j] = matrix[start:len(matrix):len(matrix)]
+		}
+	}
+	return matrix
+}
+
+// forChunks calls f with consecutive ranges of at most chunk of the n
+// elements, in parallel on up to GOMAXPROCS goroutines.
+func forChunks(n, chunk int, f func(lo, hi int)) {
+	chunks := (n + chunk - 1) / chunk
+	workers := min(runtime.GOMAXPROCS(0), chunks)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for c := w; c < chunks; c += workers {
+				f(c*chunk, min((c+1)*chunk, n))
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// projectBatch computes the dot products of the points with the rows
+// of the row-major matrix with dim columns, into out indexed by point
+// and then by row. The rows are processed in blocks that fit in the
+// L1 cache, and each block is multiplied with two points and four rows
+// at a time to reuse the loaded values, summing each dot product in
+// the same order as the kernel of Point.Dot, so the results are
+// identical to those of Point.Dot.
+func projectBatch[F Float](matrix []F, dim int, points []Vector[F], out []float64) {
+	rows := len(matrix) / dim
+	blockRows := max(4, (16<<10)/(8*dim)) &^ 3
+	for r0 := 0; r0 < rows; r0 += blockRows {
+		r1 := min(r0+blockRows, rows)
+		for p := 0; p < len(points); p += 2 {
+			x0, x1 := points[p], points[p]
+			pair := p+1 < len(points)
+			if pair {
+				x1 = points[p+1]
+			}
+			out0 := out[p*rows : (p+1)*rows]
+			out1 := out0
+			if pair {
+				out1 = out[(p+1)*rows : (p+2)*rows]
+			}
+			r := r0
+			for ; r+4 <= r1; r += 4 {
+				s := dot2x4Rows(x0, x1, matrix[r*dim:(r+4)*dim])
+				copy(out1[r:r+4], s[4:])
+				copy(out0[r:r+4], s[:4])
+			}
+			for ; r < r1; r++ {
+				a := Vector[F](matrix[r*dim : (r+1)*dim])
+				out1[r] = x1.Dot(a)
+				out0[r] = x0.Dot(a)
+			}
+		}
+	}
+}
+
+// dot2x4 returns the dot products of x0 and x1 with a0, a1, a2 and a3,
+// each summed in the same order as dotGeneric.
+func dot2x4[F Float](x0, x1, a0, a1, a2, a3 []F) (s00, s01, s02, s03, s10, s11, s12, s13 F) {
+	n := len(x0)
+	x1, a0, a1, a2, a3 = x1[:n], a0[:n], a1[:n], a2[:n], a3[:n]
+	for k := 0; k < n; k++ {
+		v0, v1 := x0[k], x1[k]
+		s00 += v0 * a0[k]
+		s01 += v0 * a1[k]
+		s02 += v0 * a2[k]
+		s03 += v0 * a3[k]
+		s10 += v1 * a0[k]
+		s11 += v1 * a1[k]
+		s12 += v1 * a2[k]
+		s13 += v1 * a3[k]
+	}
+	return
+}
+
+// hashBatch computes the projections of the points on the l x m rows
+// of matrix in parallel chunks, and calls hash with each projection
+// to get the hash value of point p for the j-th function of table i.
+func hashBatch[F Float](matrix []F, dim, l, m int, points []Vector[F], hash func(proj float64, i, j int) int) [][][]int {
+	keys := make([][][]int, len(points))
+	rows := l * m
+	forChunks(len(points), batchChunk, func(lo, hi int) {
+		proj := make([]float64, (hi-lo)*rows)
+		projectBatch(matrix, dim, points[lo:hi], proj)
+		for p := lo; p < hi; p++ {
+			hvs := make([]int, rows)
+			keys[p] = make([][]int, l)
+			for i := 0; i < l; i++ {
+				for j := 0; j < m; j++ {
+					hvs[i*m+j] = hash(proj[(p-lo)*rows+i*m+j], i, j)
+				}
+				keys[p][i] = hvs[i*m : (i+1)*m : (i+1)*m]
+			}
+		}
+	})
+	return keys
+}
+
+// batchKeys returns the combined hash values of all the points for
+// all hash tables, using HashBatch if the family implements
+// BatchFamily.
+func batchKeys[P any](family Family[P], points []P) [][]hashTableKey {
+	keys := make([][]hashTableKey, len(points))
+	bf, ok := family.(BatchFamily[P])
+	if !ok {
+		for i := range points {
+			keys[i] = hashKeys(family, points[i])
+		}
+		return keys
+	}
+	for i, hvs := range bf.HashBatch(points) {
+		keys[i] = make([]hashTableKey, len(hvs))
+		for j := range hvs {
+			keys[i][j] = hvs[j]
+		}
+	}
+	return keys
+}
+
+// batchQueryKeys returns the combined hash values of all the query
+// points for all hash tables.
+func batchQueryKeys[P any](family Family[P], queries []P) [][]hashTableKey {
+	if _, ok := family.(asymmetricFamily[P]); !ok {
+		return batchKeys(family, queries)
+	}
+	keys := make([][]hashTableKey, len(queries))
+	for i := range queries {
+		keys[i] = queryKeys(family, queries[i])
+	}
+	return keys
+}
+
+// checkBatch returns an error if the numbers of points and ids differ
+// or if the dimensionality of a point does not match.
+func checkBatch[P any, K ID](family Family[P], points []P, ids []K) error {
+	if ids != nil && len(points) != len(ids) {
+		return fmt.Errorf("lsh: %d points but %d ids", len(points), len(ids))
+	}
+	for i := range points {
+		if err := checkDim(family, points[i]); err != nil {
+			return fmt.Errorf("point %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package lsh
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func Test_HashBatch(t *testing.T) {
+	for _, dim := range []int{1, 3, 100, 1000} {
+		families := []HashFamily{
+			NewL2Family(dim, 5, 7, 4.0),
+			NewL1Family(dim, 3, 4, 4.0),
+			NewCosineFamily(dim, 4, 9),
+		}
+		// More points than a chunk, and an odd number of them.
+		points := randomPoints(2*batchChunk+3, dim, 10.0)
+		for _, family := range families {
+			keys := family.(BatchFamily[Point]).HashBatch(points)
+			for i, p := range points {
+				expected := hashKeys(family, p)
+				for j := range expected {
+					if !reflect.DeepEqual([]int(expected[j]), keys[i][j]) {
+						t.Fatalf("%T dim %d: key of point %d in table %d is %v, expected %v",
+							family, dim, i, j, keys[i][j], expected[j])
+					}
+				}
+			}
+		}
+	}
+}
+
+func Test_HashBatch32(t *testing.T) {
+	families := []Family[Point32]{
+		NewL2FamilyOf[float32](100, 5, 7, 4.0),
+		NewCosineFamilyOf[float32](100, 4, 9),
+	}
+	points := randomPointsOf[float32](batchChunk+3, 100, 10.0)
+	for _, family := range families {
+		keys := family.(BatchFamily[Point32]).HashBatch(points)
+		for i, p := range points {
+			expected := hashKeys(family, p)
+			for j := range expected {
+				if !reflect.DeepEqual([]int(expected[j]), keys[i][j]) {
+					t.Fatalf("%T: key of point %d in table %d is %v, expected %v",
+						family, i, j, keys[i][j], expected[j])
+				}
+			}
+		}
+	}
+}
+
+func Test_InsertBatch(t *testing.T) {
+	points := randomPoints(300, 20, 10.0)
+	ids := make([]string, len(points))
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	basic := NewBasicLsh(20, 5, 3, 10.0)
+	batch := NewBasicLsh(20, 5, 3, 10.0, WithVectors())
+	for i, p := range points {
+		basic.Insert(p, ids[i])
+	}
+	if err := batch.InsertBatch(points, ids); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedQuery(points, basic.Query), sortedQuery(points, batch.Query)) {
+		t.Error("InsertBatch should insert like Insert")
+	}
+	results, err := batch.QueryBatch(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedQuery(points, basic.Query), sortedQuery(results, func(ids []string) []string { return ids })) {
+		t.Error("QueryBatch should query like Query")
+	}
+	if len(batch.points) != len(points) {
+		t.Errorf("Expected %d stored vectors, found %d", len(points), len(batch.points))
+	}
+	if err := batch.InsertBatch(points[:2], ids[:1]); err == nil {
+		t.Error("InsertBatch should fail for different numbers of points and ids")
+	}
+	empty := NewBasicLsh(20, 5, 3, 10.0)
+	if err := empty.InsertBatch([]Point{points[0], {1}}, ids[:2]); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+	if len(empty.keys) != 0 {
+		t.Error("InsertBatch should not insert any point on dimension mismatch")
+	}
+	if _, err := batch.QueryBatch([]Point{{1}}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func Test_InsertBatchIndexes(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	ids := make([]string, len(points))
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	multiprobe := NewMultiprobeLsh(20, 5, 3, 10.0, 8)
+	if err := multiprobe.InsertBatch(points, ids); err != nil {
+		t.Fatal(err)
+	}
+	results, err := multiprobe.QueryBatch(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedQuery(points, multiprobe.Query), sortedQuery(results, func(ids []string) []string { return ids })) {
+		t.Error("QueryBatch should query like Query")
+	}
+
+	forest := NewLshForest(20, 5, 3, 10.0)
+	expectedForest := NewLshForest(20, 5, 3, 10.0)
+	if err := forest.InsertBatch(points, ids); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range points {
+		expectedForest.Insert(p, ids[i])
+	}
+	for i := range forest.trees {
+		if !reflect.DeepEqual(forest.trees[i].root, expectedForest.trees[i].root) {
+			t.Errorf("Tree %d differs from the tree built by Insert", i)
+		}
+	}
+	results, err = forest.QueryBatch(points, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range points {
+		if len(results[i]) != 5 {
+			t.Errorf("Expected 5 candidates, got %v", results[i])
+		}
+	}
+
+	// The MIPS family is asymmetric and inserts one point at a time.
+	mips := NewBasicLshWithFamily(NewMipsFamily(NewCosineFamily(21, 5, 4), 1))
+	if err := mips.InsertBatch(points, ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(mips.keys) != len(points) {
+		t.Errorf("Expected %d ids, found %d", len(points), len(mips.keys))
+	}
+}
+
+func benchmarkInsert(b *testing.B, batch bool) {
+	points := randomPoints(10000, 100, 32.0)
+	ids := make([]string, len(points))
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		lsh := NewBasicLsh(100, 10, 10, 5.0)
+		if batch {
+			lsh.InsertBatch(points, ids)
+			continue
+		}
+		for i, p := range points {
+			lsh.Insert(p, ids[i])
+		}
+	}
+}
+
+func Benchmark_InsertLoop(b *testing.B) {
+	benchmarkInsert(b, false)
+}
+
+func Benchmark_InsertBatch(b *testing.B) {
+	benchmarkInsert(b, true)
+}
@@ -0,0 +1,172 @@
+package lsh
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// hammer runs n goroutines for each of the operations in parallel,
+// each calling its operation with the iteration number i.
+func hammer(n, iterations int, ops ...func(i int)) {
+	var wg sync.WaitGroup
+	for _, op := range ops {
+		for g := 0; g < n; g++ {
+			wg.Add(1)
+			go func(op func(int), g int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					op(g*iterations + i)
+				}
+			}(op, g)
+		}
+	}
+	wg.Wait()
+}
+
+// checkBasicKeys checks that the keys recorded for each id, the ids in
+// the hash tables and the stored points of the LSH agree.
+func checkBasicKeys[P any, K ID](t *testing.T, index *BasicIndexOf[P, K]) {
+	t.Helper()
+	for i, table := range index.tables {
+		ids := make(map[K]bool)
+		for _, entry := range table {
+			for ; entry != nil; entry = entry.next {
+				for _, id := range entry.ids {
+					ids[id] = true
+				}
+			}
+		}
+		if len(ids) != len(index.keys) {
+			t.Errorf("Table %d has %d ids, %d have keys", i, len(ids), len(index.keys))
+		}
+		for id, fps := range index.keys {
+			if len(fps)%len(index.tables) != 0 {
+				t.Fatalf("Id %v has %d keys for %d tables", id, len(fps), len(index.tables))
+			}
+			for j := i; j < len(fps); j += len(index.tables) {
+				found := false
+				for entry := table[fps[j]]; entry != nil && !found; entry = entry.next {
+					found = slices.Contains(entry.ids, id)
+				}
+				if !found {
+					t.Errorf("Id %v not in the bucket of its key in table %d", id, i)
+				}
+			}
+		}
+	}
+	checkPoints(t, index.points, index.keys)
+}
+
+// checkForestKeys checks that the keys recorded for each id, the ids
+// in the trees and the stored points of the LSH Forest agree.
+func checkForestKeys[P any, K ID](t *testing.T, index *ForestIndexOf[P, K]) {
+	t.Helper()
+	m := index.family.NumHashes()
+	for i := range index.trees {
+		ids := make(map[K]bool)
+		var walk func(node *treeNode[K])
+		walk = func(node *treeNode[K]) {
+			for _, id := range node.ids {
+				ids[id] = true
+			}
+			for _, child := range node.children {
+				walk(child)
+			}
+		}
+		walk(index.trees[i].root)
+		if len(ids) != len(index.keys) {
+			t.Errorf("Tree %d has %d ids, %d have keys", i, len(ids), len(index.keys))
+		}
+		for id, keys := range index.keys {
+			if len(keys)%(len(index.trees)*m) != 0 {
+				t.Fatalf("Id %v has %d hash values for %d trees", id, len(keys), len(index.trees))
+			}
+			if !ids[id] {
+				t.Errorf("Id %v not in tree %d", id, i)
+			}
+		}
+	}
+	checkPoints(t, index.points, index.keys)
+}
+
+// checkPoints checks that the points are stored for the ids with keys,
+// unless the index does not store points.
+func checkPoints[P, T any, K ID](t *testing.T, points map[K]P, keys map[K][]T) {
+	t.Helper()
+	if points == nil {
+		return
+	}
+	if len(points) != len(keys) {
+		t.Errorf("%d points stored, %d ids have keys", len(points), len(keys))
+	}
+	for id := range keys {
+		if _, ok := points[id]; !ok {
+			t.Errorf("Point of id %v not stored", id)
+		}
+	}
+}
+
+func Test_BasicLshConcurrent(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	lsh := NewBasicLsh(20, 5, 3, 10.0, WithVectors())
+	hammer(4, 50,
+		func(i int) { lsh.Insert(points[i%len(points)], strconv.Itoa(i%len(points))) },
+		func(i int) { lsh.Delete(strconv.Itoa((i + 50) % len(points))) },
+		func(i int) { lsh.Upsert(points[(i+1)%len(points)], strconv.Itoa(i%len(points))) },
+		func(i int) { lsh.Query(points[i%len(points)]) },
+		func(i int) { lsh.QueryKNN(points[i%len(points)], 5) },
+	)
+	checkBasicKeys(t, lsh)
+}
+
+func Test_MultiprobeLshConcurrent(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	lsh := NewMultiprobeLsh(20, 5, 3, 10.0, 8, WithVectors())
+	hammer(4, 50,
+		func(i int) { lsh.Insert(points[i%len(points)], strconv.Itoa(i%len(points))) },
+		func(i int) { lsh.Delete(strconv.Itoa((i + 50) % len(points))) },
+		func(i int) { lsh.Query(points[i%len(points)]) },
+		func(i int) { lsh.QueryRadius(points[i%len(points)], 10.0) },
+	)
+	checkBasicKeys(t, lsh.BasicIndexOf)
+}
+
+func Test_LshForestConcurrent(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	lsh := NewLshForest(20, 5, 3, 10.0, WithVectors())
+	hammer(4, 50,
+		func(i int) { lsh.Insert(points[i%len(points)], strconv.Itoa(i%len(points))) },
+		func(i int) {
+			if i%50 == 49 {
+				lsh.Delete()
+			}
+		},
+		func(i int) { lsh.Query(points[i%len(points)], 5) },
+		func(i int) { lsh.QueryKNN(points[i%len(points)], 5) },
+		func(i int) { lsh.QueryRadius(points[i%len(points)], 10.0) },
+	)
+	checkForestKeys(t, lsh)
+	// The index is usable after being deleted.
+	lsh.Delete()
+	lsh.Insert(points[0], "0")
+	if ids := lsh.Query(points[0], 1); len(ids) != 1 || ids[0] != "0" {
+		t.Errorf("Query after Delete fail: %v", ids)
+	}
+}
+
+func Test_MipsConcurrent(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	basic := NewBasicLshWithFamily(NewMipsFamily(NewCosineFamily(21, 5, 4), 0))
+	forest := NewLshForestWithFamily(NewMipsFamily(NewCosineFamily(21, 5, 4), 0))
+	hammer(4, 50,
+		func(i int) { basic.Insert(points[i%len(points)], strconv.Itoa(i%len(points))) },
+		func(i int) { basic.Delete(strconv.Itoa((i + 50) % len(points))) },
+		func(i int) { basic.Query(points[i%len(points)]) },
+		func(i int) { forest.Insert(points[i%len(points)], strconv.Itoa(i%len(points))) },
+		func(i int) { forest.Query(points[i%len(points)], 5) },
+	)
+	checkBasicKeys(t, basic)
+	checkForestKeys(t, forest)
+}
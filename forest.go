@@ -2,19 +2,21 @@ package lsh
 
 import (
 	"fmt"
+	"io"
+	"slices"
 	"sync"
 )
 
-type treeNode struct {
+type treeNode[K ID] struct {
 	// Hash key for this intermediate node. nil/empty for root nodes.
 	hashKey int
 	// A list of ids to the source dataset, only leaf nodes have non-empty ids.
-	ids []string
+	ids []K
 	// Child nodes, keyed by partial hash value.
-	children map[int]*treeNode
+	children map[int]*treeNode[K]
 }
 
-func (node *treeNode) recursiveDelete() {
+func (node *treeNode[K]) recursiveDelete() {
 	for _, child := range node.children {
 		if len((child).children) > 0 {
 			(child).recursiveDelete()
@@ -29,19 +31,19 @@ func (node *treeNode) recursiveDelete() {
 
 // recursiveAdd recurses down the tree to find the correct location to insert id.
 // Returns whether a new hash value was added.
-func (node *treeNode) recursiveAdd(level int, id string, tableKey hashTableKey) bool {
+func (node *treeNode[K]) recursiveAdd(level int, id K, tableKey hashTableKey) bool {
 	if level == len(tableKey) {
 		node.ids = append(node.ids, id)
 		return false
 	}
 	// Check if next hash exists in children map. If not, create.
-	var next *treeNode
+	var next *treeNode[K]
 	hasNewHash := false
 	if nextNode, ok := node.children[tableKey[level]]; !ok {
-		next = &treeNode{
+		next = &treeNode[K]{
 			hashKey:  tableKey[level],
-			ids:      make([]string, 0),
-			children: make(map[int]*treeNode),
+			ids:      make([]K, 0),
+			children: make(map[int]*treeNode[K]),
 		}
 		node.children[tableKey[level]] = next
 		hasNewHash = true
@@ -53,13 +55,93 @@ func (node *treeNode) recursiveAdd(level int, id string, tableKey hashTableKey)
 	return hasNewHash || recursive
 }
 
+// recursiveRemove recurses down the tree to remove one occurrence of
+// id at the location of tableKey, pruning the nodes left empty.
+// Returns whether id was found, and whether the leaf node for
+// tableKey was pruned.
+func (node *treeNode[K]) recursiveRemove(level int, id K, tableKey hashTableKey) (found, pruned bool) {
+	if level == len(tableKey) {
+		for i, identifier := range node.ids {
+			if identifier == id {
+				node.ids = remove(node.ids, i)
+				return true, len(node.ids) == 0
+			}
+		}
+		return false, false
+	}
+	next, ok := node.children[tableKey[level]]
+	if !ok {
+		return false, false
+	}
+	found, pruned = next.recursiveRemove(level+1, id, tableKey)
+	if len(next.ids) == 0 && len(next.children) == 0 {
+		delete(node.children, tableKey[level])
+	}
+	return found, pruned
+}
+
+// encode writes the subtree rooted at node, visiting the children in
+// the order of their hash keys.
+func (node *treeNode[K]) encode(enc *encoder) {
+	enc.int(node.hashKey)
+	encodeIDs(enc, node.ids)
+	keys := make([]int, 0, len(node.children))
+	for key := range node.children {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	enc.int(len(keys))
+	for _, key := range keys {
+		node.children[key].encode(enc)
+	}
+}
+
+// decodeTreeNode reads a subtree written by encode, at the given
+// level of a tree of height maxLevel.
+func decodeTreeNode[K ID](dec *decoder, level, maxLevel int) *treeNode[K] {
+	node := &treeNode[K]{
+		hashKey:  dec.int(),
+		ids:      decodeIDs[K](dec),
+		children: make(map[int]*treeNode[K]),
+	}
+	if dec.err == nil && level < maxLevel && len(node.ids) > 0 {
+		dec.fail("ids at tree level %d", level)
+	}
+	n := dec.length()
+	if dec.err == nil && level == maxLevel && n > 0 {
+		dec.fail("tree deeper than %d levels", maxLevel)
+	}
+	for i := 0; i < n && dec.err == nil; i++ {
+		child := decodeTreeNode[K](dec, level+1, maxLevel)
+		if _, exist := node.children[child.hashKey]; exist && dec.err == nil {
+			dec.fail("duplicate tree node %d", child.hashKey)
+		}
+		node.children[child.hashKey] = child
+	}
+	return node
+}
+
+// leaves calls f with the key and id of every id in the subtree
+// rooted at node, where path is the key of node.
+func (node *treeNode[K]) leaves(path hashTableKey, f func(key hashTableKey, id K)) {
+	if len(node.ids) > 0 {
+		key := slices.Clone(path)
+		for _, id := range node.ids {
+			f(key, id)
+		}
+	}
+	for hashKey, child := range node.children {
+		child.leaves(append(path, hashKey), f)
+	}
+}
+
 func tab(times int) {
 	for i := 0; i < times; i++ {
 		fmt.Print("    ")
 	}
 }
 
-func (node *treeNode) dump(level int) {
+func (node *treeNode[K]) dump(level int) {
 	tab(level)
 	fmt.Printf("{ (%v): ids %v ", node.hashKey, node.ids)
 	if len(node.children) > 0 {
@@ -74,22 +156,40 @@ func (node *treeNode) dump(level int) {
 	}
 }
 
-type prefixTree struct {
+type prefixTree[K ID] struct {
 	// Number of distinct elements in the tree.
 	count int
 	// Pointer to the root node.
-	root *treeNode
+	root *treeNode[K]
+	// Lock guarding the tree.
+	lock sync.RWMutex
 }
 
-func (tree *prefixTree) insertIntoTree(id string, tableKey hashTableKey) {
+func (tree *prefixTree[K]) insertIntoTree(id K, tableKey hashTableKey) {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
 	if tree.root.recursiveAdd(0, id, tableKey) {
 		tree.count++
 	}
 }
 
+// removeFromTree removes one occurrence of id at the location of
+// tableKey, and returns whether it was found.
+func (tree *prefixTree[K]) removeFromTree(id K, tableKey hashTableKey) bool {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	found, pruned := tree.root.recursiveRemove(0, id, tableKey)
+	if pruned {
+		tree.count--
+	}
+	return found
+}
+
 // lookup find ids and write them to out channel
-func (tree *prefixTree) lookup(maxLevel int, tableKey hashTableKey,
-	done <-chan struct{}, out chan<- string) {
+func (tree *prefixTree[K]) lookup(maxLevel int, tableKey hashTableKey,
+	done <-chan struct{}, out chan<- K) {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
 	currentNode := tree.root
 	for level := 0; level < len(tableKey) && level < maxLevel; level++ {
 		if next, ok := currentNode.children[tableKey[level]]; ok {
@@ -100,7 +200,7 @@ func (tree *prefixTree) lookup(maxLevel int, tableKey hashTableKey,
 	}
 
 	// Grab all ids of nodes descendent from the current node.
-	queue := []*treeNode{currentNode}
+	queue := []*treeNode[K]{currentNode}
 	for len(queue) > 0 {
 		// Add node's ids to main list.
 		for _, id := range queue[0].ids {
@@ -121,69 +221,340 @@ func (tree *prefixTree) lookup(maxLevel int, tableKey hashTableKey,
 	}
 }
 
-// LshForest implements the LSH Forest algorithm by Mayank Bawa et.al.
+// collect adds the ids under the node matching the first maxLevel
+// hash values of tableKey that are not yet seen, and returns them.
+func (tree *prefixTree[K]) collect(maxLevel int, tableKey hashTableKey, seen map[K]bool) []K {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+	currentNode := tree.root
+	for level := 0; level < len(tableKey) && level < maxLevel; level++ {
+		if next, ok := currentNode.children[tableKey[level]]; ok {
+			currentNode = next
+		} else {
+			return nil
+		}
+	}
+	var ids []K
+	queue := []*treeNode[K]{currentNode}
+	for len(queue) > 0 {
+		for _, id := range queue[0].ids {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		for _, child := range queue[0].children {
+			queue = append(queue, child)
+		}
+		queue = queue[1:]
+	}
+	return ids
+}
+
+// ForestIndexOf implements the LSH Forest algorithm by Mayank Bawa
+// et.al. for inputs of type P identified by ids of type K, using a
+// family of hash functions over P.
 // It supports both nearest neighbour candidate query and k-NN query.
-type LshForest struct {
-	// Embedded type
-	*lshParams
+// It is safe for concurrent use by multiple goroutines.
+type ForestIndexOf[P any, K ID] struct {
+	// Family of hash functions.
+	family Family[P]
 	// Trees.
-	trees []prefixTree
+	trees []prefixTree[K]
+	// Keys of each id in all trees, the l*m hash values of each insert
+	// of the id.
+	keys map[K][]int
+	// Lock guarding keys.
+	keysLock sync.Mutex
+	// How Insert handles ids already in the index.
+	duplicates DuplicatePolicy
+	// Inserted points, only kept for asymmetric families or if
+	// WithVectors is used.
+	points map[K]P
+	// Lock guarding points.
+	pointsLock sync.RWMutex
+	// Lock held for reading by all operations, and for writing when
+	// an insert changes the keys of all points (asymmetric families).
+	lock sync.RWMutex
 }
 
+// ForestIndex implements the LSH Forest algorithm for inputs of type
+// P identified by string ids.
+type ForestIndex[P any] = ForestIndexOf[P, string]
+
+// LshForest implements the LSH Forest algorithm for L2 distance.
+type LshForest = ForestIndex[Point]
+
 // NewLshForest creates a new LSH Forest for L2 distance.
 // dim is the diminsionality of the data, l is the number of hash
 // tables to use, m is the number of hash values to concatenate to
 // form the key to the hash tables, w is the slot size for the
 // family of LSH functions.
-func NewLshForest(dim, l, m int, w float64) *LshForest {
-	trees := make([]prefixTree, l)
+// By default the LSH is for L2 distance, use WithMetric(L1) for L1.
+func NewLshForest(dim, l, m int, w float64, opts ...Option) *LshForest {
+	cfg := newConfig(opts)
+	return NewLshForestWithFamily(newLshParams[float64](dim, l, m, w, cfg.metric, cfg.rand()), opts...)
+}
+
+// NewLshForestFromParams creates a new LSH Forest like NewLshForest,
+// but validates the parameters and options first and returns an error
+// wrapping ErrInvalidParams if any is invalid.
+func NewLshForestFromParams(params Params, opts ...Option) (*LshForest, error) {
+	family, err := newLshParamsFromParams(params, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewLshForestWithFamily(family, opts...), nil
+}
+
+// NewLshForestWithFamily creates a new LSH Forest using the given
+// family of hash functions.
+func NewLshForestWithFamily[P any](family Family[P], opts ...Option) *ForestIndex[P] {
+	return NewForestIndexOf[string](family, opts...)
+}
+
+// NewForestIndexOf creates a new LSH Forest using the given family of
+// hash functions, for points identified by ids of type K, for example
+// NewForestIndexOf[uint64](family).
+func NewForestIndexOf[K ID, P any](family Family[P], opts ...Option) *ForestIndexOf[P, K] {
+	cfg := newConfig(opts)
+	// Asymmetric families adapt to the inserted points, so each index
+	// keeps its own copy.
+	if af, ok := family.(asymmetricFamily[P]); ok {
+		family = af.clone()
+	}
+	index := &ForestIndexOf[P, K]{
+		family:     family,
+		trees:      newPrefixTrees[K](family.NumTables()),
+		keys:       make(map[K][]int),
+		duplicates: cfg.duplicates,
+	}
+	if _, ok := family.(asymmetricFamily[P]); ok || cfg.vectors {
+		index.points = make(map[K]P)
+	}
+	return index
+}
+
+func newPrefixTrees[K ID](l int) []prefixTree[K] {
+	trees := make([]prefixTree[K], l)
 	for i := range trees {
 		trees[i].count = 0
-		trees[i].root = &treeNode{
+		trees[i].root = &treeNode[K]{
 			hashKey:  0,
-			ids:      make([]string, 0),
-			children: make(map[int]*treeNode),
+			ids:      make([]K, 0),
+			children: make(map[int]*treeNode[K]),
 		}
 	}
-	return &LshForest{
-		lshParams: newLshParams(dim, l, m, w),
-		trees:     trees,
-	}
+	return trees
 }
 
 // Delete releases the memory used by this index.
-func (index *LshForest) Delete() {
-	for _, tree := range index.trees {
-		(*tree.root).recursiveDelete()
+func (index *ForestIndexOf[P, K]) Delete() {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	for i := range index.trees {
+		tree := &index.trees[i]
+		tree.lock.Lock()
+		tree.root.recursiveDelete()
+		tree.root.children = make(map[int]*treeNode[K])
+		tree.count = 0
+		tree.lock.Unlock()
 	}
+	index.keysLock.Lock()
+	clear(index.keys)
+	index.keysLock.Unlock()
+	index.pointsLock.Lock()
+	clear(index.points)
+	index.pointsLock.Unlock()
 }
 
-// Insert adds a new data point to the LSH Forest.
+// Remove removes a data point from the LSH Forest, including all the
+// times it was inserted, and prunes the tree nodes left empty.
 // id is the unique identifier for the data point.
-func (index *LshForest) Insert(point Point, id string) {
-	// Apply hash functions.
-	hvs := index.hash(point)
+// It returns an error wrapping ErrNotFound if id is not in the index.
+func (index *ForestIndexOf[P, K]) Remove(id K) error {
+	// Inserts of the same id only hold the lock for reading, so
+	// removing excludes them to not leave the id partly inserted.
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	if !index.remove(id) {
+		return fmt.Errorf("%w: %v", ErrNotFound, id)
+	}
+	return nil
+}
+
+// remove removes id from the LSH Forest, and returns whether it was
+// found. The lock must be held for writing.
+func (index *ForestIndexOf[P, K]) remove(id K) bool {
+	index.keysLock.Lock()
+	keys, exist := index.keys[id]
+	delete(index.keys, id)
+	index.keysLock.Unlock()
+	if !exist {
+		return false
+	}
+	index.pointsLock.Lock()
+	delete(index.points, id)
+	index.pointsLock.Unlock()
+	// Parallel remove
+	var wg sync.WaitGroup
+	wg.Add(len(index.trees))
+	for i := range index.trees {
+		tree := &(index.trees[i])
+		go func(i int, tree *prefixTree[K]) {
+			m := index.family.NumHashes()
+			for j := i * m; j < len(keys); j += len(index.trees) * m {
+				tree.removeFromTree(id, keys[j:j+m])
+			}
+			wg.Done()
+		}(i, tree)
+	}
+	wg.Wait()
+	return true
+}
+
+// Insert adds a new data point to the LSH Forest.
+// id is the unique identifier for the data point, an id already in
+// the index is handled according to the DuplicatePolicy.
+// It panics if the dimensionality of point does not match, or if id
+// is rejected as a duplicate.
+func (index *ForestIndexOf[P, K]) Insert(point P, id K) {
+	if err := index.TryInsert(point, id); err != nil {
+		panic(err)
+	}
+}
+
+// TryInsert adds a new data point to the LSH Forest like Insert, but
+// returns an error wrapping ErrDimensionMismatch or ErrDuplicateID
+// instead of panicking.
+func (index *ForestIndexOf[P, K]) TryInsert(point P, id K) error {
+	return index.tryInsert(point, id, index.duplicates)
+}
+
+// Upsert adds a new data point to the LSH Forest, replacing atomically
+// all the existing entries for id, if any.
+// It returns an error wrapping ErrDimensionMismatch if the
+// dimensionality of point does not match.
+func (index *ForestIndexOf[P, K]) Upsert(point P, id K) error {
+	return index.tryInsert(point, id, ReplaceDuplicates)
+}
+
+func (index *ForestIndexOf[P, K]) tryInsert(point P, id K, duplicates DuplicatePolicy) error {
+	if err := checkDim(index.family, point); err != nil {
+		return err
+	}
+	family, asymmetric := index.family.(asymmetricFamily[P])
+	if asymmetric || duplicates != AllowDuplicates {
+		index.lock.Lock()
+		defer index.lock.Unlock()
+	} else {
+		index.lock.RLock()
+		defer index.lock.RUnlock()
+	}
+	if duplicates != AllowDuplicates {
+		if _, exist := index.keys[id]; exist {
+			if duplicates == RejectDuplicates {
+				return fmt.Errorf("%w: %v", ErrDuplicateID, id)
+			}
+			index.remove(id)
+		}
+	}
+	if asymmetric && family.fit(point) {
+		index.rehash()
+	}
+	if index.points != nil {
+		index.pointsLock.Lock()
+		index.points[id] = point
+		index.pointsLock.Unlock()
+	}
+	index.insert([][]hashTableKey{hashKeys(index.family, point)}, []K{id})
+	return nil
+}
+
+// InsertBatch adds the data points to the LSH Forest, where ids[i] is
+// the unique identifier for points[i]. The points are hashed together,
+// which is faster than inserting them one at a time for families
+// implementing BatchFamily.
+// It returns an error wrapping ErrDimensionMismatch before inserting
+// any point if the dimensionality of a point does not match. Ids
+// already in the index are handled according to the DuplicatePolicy,
+// and an error wrapping ErrDuplicateID stops the insertion.
+func (index *ForestIndexOf[P, K]) InsertBatch(points []P, ids []K) error {
+	if err := checkBatch(index.family, points, ids); err != nil {
+		return err
+	}
+	if _, ok := index.family.(asymmetricFamily[P]); ok || index.duplicates != AllowDuplicates {
+		for i := range points {
+			if err := index.TryInsert(points[i], ids[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	keys := batchKeys(index.family, points)
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	if index.points != nil {
+		index.pointsLock.Lock()
+		for i, id := range ids {
+			index.points[id] = points[i]
+		}
+		index.pointsLock.Unlock()
+	}
+	index.insert(keys, ids)
+	return nil
+}
+
+// rehash rebuilds the trees from the inserted points.
+// The lock must be held for writing.
+func (index *ForestIndexOf[P, K]) rehash() {
+	index.trees = newPrefixTrees[K](len(index.trees))
+	clear(index.keys)
+	ids := make([]K, 0, len(index.points))
+	points := make([]P, 0, len(index.points))
+	for id, point := range index.points {
+		ids = append(ids, id)
+		points = append(points, point)
+	}
+	index.insert(batchKeys(index.family, points), ids)
+}
+
+// insert adds each ids[k] to all trees at the keys hvs[k].
+func (index *ForestIndexOf[P, K]) insert(hvs [][]hashTableKey, ids []K) {
 	// Parallel insert
 	var wg sync.WaitGroup
 	wg.Add(len(index.trees))
 	for i := range index.trees {
-		hv := hvs[i]
 		tree := &(index.trees[i])
-		go func(tree *prefixTree, hv hashTableKey) {
-			tree.insertIntoTree(id, hv)
+		go func(i int, tree *prefixTree[K]) {
+			for k, id := range ids {
+				tree.insertIntoTree(id, hvs[k][i])
+			}
 			wg.Done()
-		}(tree, hv)
+		}(i, tree)
 	}
 	wg.Wait()
+	// Record the keys after the ids are in all trees, so Remove
+	// always finds the ids at the recorded keys.
+	index.keysLock.Lock()
+	m := index.family.NumHashes()
+	for k, id := range ids {
+		keys := slices.Grow(index.keys[id], len(hvs[k])*m)
+		for _, key := range hvs[k] {
+			keys = append(keys, key...)
+		}
+		index.keys[id] = keys
+	}
+	index.keysLock.Unlock()
 }
 
 // Helper that queries all trees and returns an channel ids.
-func (index *LshForest) queryHelper(maxLevel int, tableKeys []hashTableKey, done <-chan struct{}, out chan<- string) {
+func (index *ForestIndexOf[P, K]) queryHelper(maxLevel int, tableKeys []hashTableKey, done <-chan struct{}, out chan<- K) {
 	var wg sync.WaitGroup
 	wg.Add(len(index.trees))
 	for i := range index.trees {
 		key := tableKeys[i]
-		tree := index.trees[i]
+		tree := &index.trees[i]
 		go func() {
 			tree.lookup(maxLevel, key, done, out)
 			wg.Done()
@@ -194,14 +565,53 @@ func (index *LshForest) queryHelper(maxLevel int, tableKeys []hashTableKey, done
 
 // Query finds at top-k ids of approximate nearest neighbour candidates,
 // in unsorted order, given the query point.
-func (index *LshForest) Query(q Point, k int) []string {
+// It panics if the dimensionality of q does not match.
+func (index *ForestIndexOf[P, K]) Query(q P, k int) []K {
+	ids, err := index.TryQuery(q, k)
+	if err != nil {
+		panic(err)
+	}
+	return ids
+}
+
+// TryQuery finds the candidates like Query, but returns an error
+// wrapping ErrDimensionMismatch instead of panicking.
+func (index *ForestIndexOf[P, K]) TryQuery(q P, k int) ([]K, error) {
+	if err := checkDim(index.family, q); err != nil {
+		return nil, err
+	}
+	index.lock.RLock()
+	defer index.lock.RUnlock()
 	// Apply hash functions
-	hvs := index.hash(q)
+	return index.query(queryKeys(index.family, q), k), nil
+}
+
+// QueryBatch finds the candidates of each query point like Query,
+// hashing all the query points together.
+// It returns an error wrapping ErrDimensionMismatch if the
+// dimensionality of a query point does not match.
+func (index *ForestIndexOf[P, K]) QueryBatch(queries []P, k int) ([][]K, error) {
+	if err := checkBatch[P, K](index.family, queries, nil); err != nil {
+		return nil, err
+	}
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	results := make([][]K, len(queries))
+	for i, hvs := range batchQueryKeys(index.family, queries) {
+		results[i] = index.query(hvs, k)
+	}
+	return results, nil
+}
+
+// query returns at most k ids sharing the longest prefixes with the
+// keys hvs. The lock must be held.
+func (index *ForestIndexOf[P, K]) query(hvs []hashTableKey, k int) []K {
 	// Query
-	results := make(chan string)
+	results := make(chan K)
 	done := make(chan struct{})
 	go func() {
-		for maxLevels := index.m; maxLevels >= 0; maxLevels-- {
+		defer close(results)
+		for maxLevels := index.family.NumHashes(); maxLevels >= 0; maxLevels-- {
 			select {
 			case <-done:
 				return
@@ -209,9 +619,8 @@ func (index *LshForest) Query(q Point, k int) []string {
 				index.queryHelper(maxLevels, hvs, done, results)
 			}
 		}
-		close(results)
 	}()
-	seen := make(map[string]bool)
+	seen := make(map[K]bool)
 	for id := range results {
 		if len(seen) >= k {
 			break
@@ -222,18 +631,164 @@ func (index *LshForest) Query(q Point, k int) []string {
 		seen[id] = true
 	}
 	close(done)
+	// Wait for the lookups to stop before releasing the lock.
+	for range results {
+	}
 	// Collect results
-	ids := make([]string, 0, len(seen))
+	ids := make([]K, 0, len(seen))
 	for id := range seen {
 		ids = append(ids, id)
 	}
 	return ids
 }
 
+// QueryKNN finds the k nearest neighbours, sorted by ascending exact
+// distance to the query point, by ranking the top l*k candidates
+// returned by Query where l is the number of trees.
+// The index must store vectors (see WithVectors).
+// It panics if the dimensionality of q does not match or if the index
+// does not store vectors.
+func (index *ForestIndexOf[P, K]) QueryKNN(q P, k int) []NeighborOf[K] {
+	neighbors, err := index.TryQueryKNN(q, k)
+	if err != nil {
+		panic(err)
+	}
+	return neighbors
+}
+
+// TryQueryKNN finds the k nearest neighbours like QueryKNN, but
+// returns an error wrapping ErrDimensionMismatch or ErrNoVectors
+// instead of panicking.
+func (index *ForestIndexOf[P, K]) TryQueryKNN(q P, k int) ([]NeighborOf[K], error) {
+	if err := checkVectors(index.family, index.points); err != nil {
+		return nil, err
+	}
+	candidates, err := index.TryQuery(q, len(index.trees)*k)
+	if err != nil {
+		return nil, err
+	}
+	index.pointsLock.RLock()
+	defer index.pointsLock.RUnlock()
+	return rankNeighbors(index.family, index.points, q, candidates, k), nil
+}
+
+// QueryRadius finds the points within distance r of the query point,
+// sorted by ascending exact distance. It descends to shallower prefix
+// levels of the trees until a level adds new candidates none of which
+// are within distance r.
+// The index must store vectors (see WithVectors).
+// It panics if the dimensionality of q does not match or if the index
+// does not store vectors.
+func (index *ForestIndexOf[P, K]) QueryRadius(q P, r float64) []NeighborOf[K] {
+	neighbors, err := index.TryQueryRadius(q, r)
+	if err != nil {
+		panic(err)
+	}
+	return neighbors
+}
+
+// TryQueryRadius finds the points within distance r like QueryRadius,
+// but returns an error wrapping ErrDimensionMismatch or ErrNoVectors
+// instead of panicking.
+func (index *ForestIndexOf[P, K]) TryQueryRadius(q P, r float64) ([]NeighborOf[K], error) {
+	if err := checkVectors(index.family, index.points); err != nil {
+		return nil, err
+	}
+	if err := checkDim(index.family, q); err != nil {
+		return nil, err
+	}
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	index.pointsLock.RLock()
+	defer index.pointsLock.RUnlock()
+	hvs := queryKeys(index.family, q)
+	seen := make(map[K]bool)
+	results := make([]NeighborOf[K], 0)
+	for maxLevel := index.family.NumHashes(); maxLevel >= 0; maxLevel-- {
+		var candidates []K
+		for i := range index.trees {
+			candidates = append(candidates, index.trees[i].collect(maxLevel, hvs[i], seen)...)
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		within := withinRadius(measureNeighbors(index.family, index.points, q, candidates), r)
+		if len(within) == 0 {
+			break
+		}
+		results = append(results, within...)
+	}
+	sortNeighbors(results)
+	return results, nil
+}
+
 // Dump prints out the index for debugging
-func (index *LshForest) dump() {
-	for i, tree := range index.trees {
+func (index *ForestIndexOf[P, K]) dump() {
+	for i := range index.trees {
+		tree := &index.trees[i]
 		fmt.Printf("Tree %d (%d hash values):\n", i, tree.count)
 		tree.root.dump(0)
 	}
 }
+
+// WriteTo writes the LSH Forest to w in a versioned and checksummed
+// binary format, including the hash functions and the stored vectors,
+// and returns the number of bytes written. It implements io.WriterTo.
+// Only the families of hash functions of this package and points of
+// type Point, BinaryPoint or []uint64 can be written.
+func (index *ForestIndexOf[P, K]) WriteTo(w io.Writer) (int64, error) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	enc := newEncoder(w, kindForest, idKind[K]())
+	encodeFamily(enc, index.family)
+	enc.int(int(index.duplicates))
+	enc.int(len(index.trees))
+	for i := range index.trees {
+		enc.int(index.trees[i].count)
+		index.trees[i].root.encode(enc)
+	}
+	encodePoints(enc, index.points)
+	return enc.finish()
+}
+
+// ReadFrom replaces the LSH Forest with the one written by WriteTo to
+// r, and returns the number of bytes read. It implements
+// io.ReaderFrom.
+// It returns an error wrapping ErrInvalidFormat if the data is
+// corrupt or was not written by a ForestIndex of the same type.
+// ReadFrom buffers reads from r unless r is a *bufio.Reader, and must
+// not be called concurrently with other methods.
+func (index *ForestIndexOf[P, K]) ReadFrom(r io.Reader) (int64, error) {
+	dec := newDecoder(r, kindForest, idKind[K]())
+	family := decodeTypedFamily[P](dec)
+	if dec.err != nil {
+		return dec.n, dec.err
+	}
+	loaded := NewForestIndexOf[K](family)
+	duplicates := DuplicatePolicy(dec.int())
+	if dec.err == nil && (duplicates < AllowDuplicates || duplicates > ReplaceDuplicates) {
+		dec.fail("unknown duplicate policy %d", duplicates)
+	}
+	if l := dec.length(); dec.err == nil && l != len(loaded.trees) {
+		dec.fail("expected %d trees, found %d", len(loaded.trees), l)
+	}
+	for i := 0; i < len(loaded.trees) && dec.err == nil; i++ {
+		loaded.trees[i].count = dec.length()
+		loaded.trees[i].root = decodeTreeNode[K](dec, 0, family.NumHashes())
+	}
+	keys := indexKeys(dec, len(loaded.trees), family.NumHashes(), func(i int, add func(K, []int)) {
+		loaded.trees[i].root.leaves(nil, func(key hashTableKey, id K) {
+			add(id, key)
+		})
+	})
+	points := decodePoints[P, K](dec)
+	if n, err := dec.finish(); err != nil {
+		return n, err
+	}
+	index.family = family
+	index.trees = loaded.trees
+	index.keys = keys
+	index.points = points
+	index.duplicates = duplicates
+	return dec.n, nil
+}
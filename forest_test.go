@@ -1,6 +1,7 @@
 package lsh
 
 import (
+	"errors"
 	"strconv"
 	"testing"
 )
@@ -18,8 +19,8 @@ func Test_LshForestInsert(t *testing.T) {
 	for i, p := range points {
 		lsh.Insert(p, strconv.Itoa(i))
 	}
-	for _, trees := range lsh.trees {
-		if trees.count == 0 {
+	for i := range lsh.trees {
+		if lsh.trees[i].count == 0 {
 			t.Error("Insert fail")
 		}
 	}
@@ -48,3 +49,103 @@ func Test_LshForestQuery(t *testing.T) {
 		}
 	}
 }
+
+func Test_LshForestQueryKNN(t *testing.T) {
+	lsh := NewLshForest(100, 5, 5, 50.0, WithVectors())
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		checkNeighbors(t, lsh.QueryKNN(p, 3), p, points, strconv.Itoa(i), 3)
+	}
+}
+
+func Test_LshForestQueryRadius(t *testing.T) {
+	lsh := NewLshForest(100, 5, 5, 50.0, WithVectors())
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		checkRadius(t, lsh.QueryRadius(p, 130.0), p, points, strconv.Itoa(i), 130.0)
+	}
+	// A radius covering all points finds all of them.
+	if n := len(lsh.QueryRadius(points[0], 1e6)); n != len(points) {
+		t.Errorf("Expected %d points within radius, found %d", len(points), n)
+	}
+}
+
+func Test_LshForestRemove(t *testing.T) {
+	lsh := NewLshForest(100, 5, 5, 5.0)
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	// Insert a duplicate, which is removed as well.
+	lsh.Insert(points[0], "0")
+	for i := range points {
+		if err := lsh.Remove(strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range lsh.Query(points[i], 5) {
+			if id == strconv.Itoa(i) {
+				t.Error("Remove fail")
+			}
+		}
+	}
+	// All nodes are pruned from the trees.
+	for i := range lsh.trees {
+		if lsh.trees[i].count != 0 || len(lsh.trees[i].root.children) != 0 {
+			t.Errorf("Tree %d not pruned: count %d", i, lsh.trees[i].count)
+		}
+	}
+	if err := lsh.Remove("0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func Test_LshForestRemoveCount(t *testing.T) {
+	lsh := NewLshForest(2, 1, 3, 5.0)
+	p := Point{1, 2}
+	lsh.Insert(p, "a")
+	lsh.Insert(p, "b")
+	if lsh.trees[0].count != 1 {
+		t.Fatalf("Expected count 1, got %d", lsh.trees[0].count)
+	}
+	// The leaf still holds b, so it is not pruned.
+	lsh.Remove("a")
+	if lsh.trees[0].count != 1 {
+		t.Errorf("Expected count 1, got %d", lsh.trees[0].count)
+	}
+	if ids := lsh.Query(p, 1); len(ids) != 1 || ids[0] != "b" {
+		t.Errorf("Expected [b], got %v", ids)
+	}
+	lsh.Remove("b")
+	if lsh.trees[0].count != 0 {
+		t.Errorf("Expected count 0, got %d", lsh.trees[0].count)
+	}
+}
+
+func Test_LshForestUpsert(t *testing.T) {
+	lsh := NewLshForest(100, 5, 5, 5.0, WithDuplicatePolicy(RejectDuplicates))
+	points := randomPoints(2, 100, 32.0)
+	lsh.Insert(points[0], "a")
+	if err := lsh.TryInsert(points[1], "a"); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+	if err := lsh.Upsert(points[1], "a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(lsh.keys["a"]) != 5*5 {
+		t.Errorf("Expected 1 insert of a, found %d hash values", len(lsh.keys["a"]))
+	}
+	for i := range lsh.trees {
+		if lsh.trees[i].count != 1 {
+			t.Errorf("Expected count 1 in tree %d, got %d", i, lsh.trees[i].count)
+		}
+	}
+	if ids := lsh.Query(points[1], 1); len(ids) != 1 || ids[0] != "a" {
+		t.Errorf("Expected [a], got %v", ids)
+	}
+}
@@ -0,0 +1,396 @@
+package lsh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+)
+
+// The frozen format written by WriteFrozen starts with the header of
+// the binary format for kindFrozen, the family of hash functions and
+// the perturbation vectors, followed by the CRC-32 of the header.
+// The rest of the file is not checksummed, so that opening it does not
+// read the tables, and is laid out in sections aligned to 8 bytes:
+//
+//	number of ids n, n+1 offsets of the ids, the bytes of the ids
+//	(strings, or 8 bytes for integer ids)
+//	for each table:
+//		number of buckets b, b sorted fingerprints of the bucket keys,
+//		the b bucket keys of m int64 each, b+1 offsets of the buckets,
+//		the uint32 id numbers of the buckets
+//
+// All integers are little endian, and offsets are uint64.
+
+// WriteFrozen writes the LSH to w in the compact read-only format
+// opened by OpenFrozenIndex, and returns the number of bytes written.
+// The stored vectors are not written.
+// Only the families of hash functions of this package can be written.
+func (index *BasicIndexOf[P, K]) WriteFrozen(w io.Writer) (int64, error) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	return writeFrozen(w, index.family, index.tables, nil)
+}
+
+// WriteFrozen writes the LSH to w in the compact read-only format
+// opened by OpenFrozenIndex, including the perturbation vectors, and
+// returns the number of bytes written.
+// The stored vectors are not written.
+// Only the families of hash functions of this package can be written.
+func (index *MultiprobeIndexOf[P, K]) WriteFrozen(w io.Writer) (int64, error) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	return writeFrozen(w, index.family, index.tables, index.perturbVecs)
+}
+
+func writeFrozen[K ID](w io.Writer, family any, tables []hashTable[K], perturbVecs [][][]int) (int64, error) {
+	enc := newEncoder(w, kindFrozen, idKind[K]())
+	encodeFamily(enc, family)
+	encodePerturbVecs(enc, perturbVecs)
+	enc.checksum()
+	enc.align()
+	// Number the ids in sorted order.
+	numbers := make(map[K]uint32)
+	for _, table := range tables {
+		for _, entry := range table {
+			for ; entry != nil; entry = entry.next {
+				for _, id := range entry.ids {
+					numbers[id] = 0
+				}
+			}
+		}
+	}
+	if uint64(len(numbers)) > math.MaxUint32 {
+		enc.fail(fmt.Errorf("lsh: too many ids for the frozen format: %d", len(numbers)))
+	}
+	ids := make([]K, 0, len(numbers))
+	for id := range numbers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	enc.int(len(ids))
+	var idBytes []byte
+	enc.int(0)
+	for i, id := range ids {
+		numbers[id] = uint32(i)
+		idBytes = appendID(idBytes, id)
+		enc.int(len(idBytes))
+	}
+	enc.write(idBytes)
+	enc.align()
+	for _, table := range tables {
+		entries, fps := table.sorted()
+		enc.int(len(entries))
+		for _, fp := range fps {
+			enc.uint64(uint64(fp))
+		}
+		for _, entry := range entries {
+			for _, hashVal := range entry.key {
+				enc.int(hashVal)
+			}
+		}
+		offset := 0
+		enc.int(offset)
+		for _, entry := range entries {
+			offset += len(entry.ids)
+			enc.int(offset)
+		}
+		for _, entry := range entries {
+			for _, id := range entry.ids {
+				enc.uint32(numbers[id])
+			}
+		}
+		enc.align()
+	}
+	return enc.flush()
+}
+
+// frozenReader reads the sections of the frozen format, keeping the
+// first error.
+type frozenReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (fr *frozenReader) fail(format string, args ...any) {
+	if fr.err == nil {
+		fr.err = fmt.Errorf("%w: "+format, append([]any{ErrInvalidFormat}, args...)...)
+	}
+}
+
+// section returns the next n elements of size bytes, and skips to the
+// next multiple of 8 bytes.
+func (fr *frozenReader) section(n, size int) []byte {
+	if fr.err != nil {
+		return nil
+	}
+	if n < 0 || n > (len(fr.data)-fr.off)/size {
+		fr.fail("section of %d elements at offset %d exceeds the file", n, fr.off)
+		return nil
+	}
+	s := fr.data[fr.off : fr.off+n*size]
+	fr.off += (n*size + 7) &^ 7
+	fr.off = min(fr.off, len(fr.data))
+	return s
+}
+
+// length reads a length, which must not be negative.
+func (fr *frozenReader) length() int {
+	s := fr.section(1, 8)
+	if s == nil {
+		return 0
+	}
+	n := int(binary.LittleEndian.Uint64(s))
+	if n < 0 {
+		fr.fail("negative length %d", n)
+		return 0
+	}
+	return n
+}
+
+// offsets is a section of n+1 uint64 offsets into a section of bytes
+// or elements.
+type offsets []byte
+
+// get returns the i-th range of elements, and whether it is within
+// the limit. The ranges are checked when used rather than on opening,
+// so that opening does not read all the offsets.
+func (o offsets) get(i, limit int) (int, int, bool) {
+	lo := binary.LittleEndian.Uint64(o[8*i:])
+	hi := binary.LittleEndian.Uint64(o[8*i+8:])
+	if lo > hi || hi > uint64(limit) {
+		return 0, 0, false
+	}
+	return int(lo), int(hi), true
+}
+
+// last returns the last offset.
+func (o offsets) last() int {
+	return int(binary.LittleEndian.Uint64(o[len(o)-8:]))
+}
+
+// frozenTable is a hash table of the frozen format.
+type frozenTable struct {
+	// Number of buckets.
+	n int
+	// Sorted fingerprints of the bucket keys.
+	fingerprints []byte
+	// Bucket keys of m hash values each.
+	keys []byte
+	// Offsets of the buckets in ids.
+	idOffsets offsets
+	// Id numbers of the buckets.
+	ids []byte
+}
+
+// keyEqual returns whether the key of the i-th bucket is key.
+func (table *frozenTable) keyEqual(i int, key hashTableKey) bool {
+	stored := table.keys[8*i*len(key):]
+	for j, hashVal := range key {
+		if int(binary.LittleEndian.Uint64(stored[8*j:])) != hashVal {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup calls add with the id number of every id in the bucket of
+// key.
+func (table *frozenTable) lookup(key hashTableKey, add func(uint32)) {
+	fp := uint64(key.fingerprint())
+	fingerprintAt := func(i int) uint64 {
+		return binary.LittleEndian.Uint64(table.fingerprints[8*i:])
+	}
+	i := sort.Search(table.n, func(i int) bool { return fingerprintAt(i) >= fp })
+	// Verify the full key, as distinct keys can share a fingerprint.
+	for ; i < table.n && fingerprintAt(i) == fp; i++ {
+		if !table.keyEqual(i, key) {
+			continue
+		}
+		lo, hi, ok := table.idOffsets.get(i, len(table.ids)/4)
+		if !ok {
+			return
+		}
+		for j := lo; j < hi; j++ {
+			add(binary.LittleEndian.Uint32(table.ids[4*j:]))
+		}
+		return
+	}
+}
+
+// FrozenIndexOf is a read-only LSH for inputs of type P identified by
+// ids of type K, opened from the compact format written by
+// WriteFrozen. The file is memory-mapped where supported and queried
+// in place, without loading the hash tables into Go maps.
+// It is safe for concurrent use by multiple goroutines until Close.
+type FrozenIndexOf[P any, K ID] struct {
+	// Family of hash functions.
+	family Family[P]
+	// Perturbation vectors of the probe sequence, nil for the basic
+	// LSH algorithm.
+	perturbVecs [][][]int
+	// Contents of the file.
+	data []byte
+	// Offsets of the ids in idBytes.
+	idOffsets offsets
+	// Bytes of the ids.
+	idBytes []byte
+	// Hash tables.
+	tables []frozenTable
+}
+
+// FrozenIndex is a read-only LSH for inputs of type P identified by
+// string ids.
+type FrozenIndex[P any] = FrozenIndexOf[P, string]
+
+// FrozenLsh is a read-only LSH for L2 distance, opened from a
+// BasicLsh or MultiprobeLsh written by WriteFrozen.
+type FrozenLsh = FrozenIndex[Point]
+
+// OpenFrozenLsh opens the file at path written by WriteFrozen of a
+// BasicLsh or MultiprobeLsh.
+func OpenFrozenLsh(path string) (*FrozenLsh, error) {
+	return OpenFrozenIndex[Point](path)
+}
+
+// OpenFrozenIndex opens the file at path written by WriteFrozen of an
+// index for inputs of type P. The index must be closed with Close.
+// It returns an error wrapping ErrInvalidFormat if the file is
+// corrupt or was not written for inputs of type P.
+func OpenFrozenIndex[P any](path string) (*FrozenIndex[P], error) {
+	return OpenFrozenIndexOf[string, P](path)
+}
+
+// OpenFrozenIndexOf opens the file at path like OpenFrozenIndex, for an
+// index with ids of type K. It returns an error wrapping
+// ErrInvalidFormat if the file was written with another type of ids.
+func OpenFrozenIndexOf[K ID, P any](path string) (*FrozenIndexOf[P, K], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size != int64(int(size)) {
+		return nil, fmt.Errorf("lsh: file too large to map: %d bytes", size)
+	}
+	data, err := mmapFile(f, int(size))
+	if err != nil {
+		return nil, err
+	}
+	index, err := newFrozenIndex[P, K](data)
+	if err != nil {
+		munmapFile(data)
+		return nil, err
+	}
+	return index, nil
+}
+
+func newFrozenIndex[P any, K ID](data []byte) (*FrozenIndexOf[P, K], error) {
+	dec := newDecoder(bytes.NewReader(data), kindFrozen, idKind[K]())
+	family := decodeTypedFamily[P](dec)
+	index := &FrozenIndexOf[P, K]{
+		family: family,
+		data:   data,
+	}
+	if dec.err == nil {
+		index.perturbVecs = decodePerturbVecs(dec, family.NumTables(), family.NumHashes())
+	}
+	if _, err := dec.finish(); err != nil {
+		return nil, err
+	}
+	// The sections start after the header, aligned to 8 bytes.
+	fr := &frozenReader{
+		data: data,
+		off:  min((int(dec.n)+7)&^7, len(data)),
+	}
+	n := fr.length()
+	index.idOffsets = fr.section(n+1, 8)
+	if fr.err == nil {
+		index.idBytes = fr.section(index.idOffsets.last(), 1)
+	}
+	index.tables = make([]frozenTable, family.NumTables())
+	for i := range index.tables {
+		table := &index.tables[i]
+		table.n = fr.length()
+		table.fingerprints = fr.section(table.n, 8)
+		if table.n > len(data)/8/family.NumHashes() {
+			fr.fail("%d buckets exceed the file", table.n)
+		}
+		table.keys = fr.section(table.n*family.NumHashes(), 8)
+		table.idOffsets = fr.section(table.n+1, 8)
+		if fr.err != nil {
+			break
+		}
+		table.ids = fr.section(table.idOffsets.last(), 4)
+	}
+	if fr.err != nil {
+		return nil, fr.err
+	}
+	return index, nil
+}
+
+// Close unmaps the file of the index, which must not be used after.
+func (index *FrozenIndexOf[P, K]) Close() error {
+	data := index.data
+	index.data = nil
+	index.idBytes = nil
+	index.tables = nil
+	return munmapFile(data)
+}
+
+// Query finds the ids of approximate nearest neighbour candidates,
+// in un-sorted order, given the query point.
+// It panics if the dimensionality of q does not match.
+func (index *FrozenIndexOf[P, K]) Query(q P) []K {
+	ids, err := index.TryQuery(q)
+	if err != nil {
+		panic(err)
+	}
+	return ids
+}
+
+// TryQuery finds the candidates like Query, but returns an error
+// wrapping ErrDimensionMismatch instead of panicking.
+func (index *FrozenIndexOf[P, K]) TryQuery(q P) ([]K, error) {
+	if err := checkDim(index.family, q); err != nil {
+		return nil, err
+	}
+	baseKey := queryKeys(index.family, q)
+	seen := make(map[uint32]bool)
+	add := func(number uint32) {
+		seen[number] = true
+	}
+	for i := 0; i < len(index.perturbVecs)+1; i++ {
+		tableKeys := baseKey
+		if i != 0 {
+			tableKeys = perturbKeys(index.family, baseKey, index.perturbVecs[i-1])
+		}
+		for j, hv := range tableKeys {
+			index.tables[j].lookup(hv, add)
+		}
+	}
+	// Collect results
+	ids := make([]K, 0, len(seen))
+	numIDs := len(index.idOffsets)/8 - 1
+	for number := range seen {
+		if int(number) >= numIDs {
+			continue
+		}
+		if lo, hi, ok := index.idOffsets.get(int(number), len(index.idBytes)); ok {
+			if id, ok := parseID[K](index.idBytes[lo:hi]); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,112 @@
+package lsh
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// writeFrozenFile writes an index with WriteFrozen to a temporary file
+// and returns its path.
+func writeFrozenFile(t *testing.T, write func(*os.File) error) string {
+	path := filepath.Join(t.TempDir(), "index.lsh")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := write(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_FrozenLsh(t *testing.T) {
+	points := randomPoints(200, 20, 10.0)
+	basic := NewBasicLsh(20, 5, 3, 10.0)
+	multiprobe := NewMultiprobeLsh(20, 5, 3, 10.0, 8)
+	for i, p := range points {
+		basic.Insert(p, strconv.Itoa(i))
+		multiprobe.Insert(p, strconv.Itoa(i))
+	}
+	basic.Insert(points[0], "0")
+	for name, index := range map[string]interface {
+		Query(Point) []string
+		WriteFrozen(w io.Writer) (int64, error)
+	}{"basic": basic, "multiprobe": multiprobe} {
+		path := writeFrozenFile(t, func(f *os.File) error {
+			_, err := index.WriteFrozen(f)
+			return err
+		})
+		frozen, err := OpenFrozenLsh(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(sortedQuery(points, index.Query), sortedQuery(points, frozen.Query)) {
+			t.Errorf("Frozen %s index should return the same candidates", name)
+		}
+		if _, err := frozen.TryQuery(Point{1}); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+		}
+		if err := frozen.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func Test_FrozenHamming(t *testing.T) {
+	points := randomBinaryPoints(100, 128)
+	lsh := NewMultiprobeLshWithFamily(NewHammingFamily(128, 5, 10), 6)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	path := writeFrozenFile(t, func(f *os.File) error {
+		_, err := lsh.WriteFrozen(f)
+		return err
+	})
+	if _, err := OpenFrozenLsh(path); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for another point type, got %v", err)
+	}
+	frozen, err := OpenFrozenIndex[BinaryPoint](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frozen.Close()
+	if !reflect.DeepEqual(sortedQuery(points, lsh.Query), sortedQuery(points, frozen.Query)) {
+		t.Error("Frozen index should return the same candidates")
+	}
+}
+
+func Test_OpenFrozenInvalid(t *testing.T) {
+	lsh := NewBasicLsh(20, 5, 3, 10.0)
+	for i, p := range randomPoints(50, 20, 10.0) {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	path := writeFrozenFile(t, func(f *os.File) error {
+		_, err := lsh.WriteTo(f)
+		return err
+	})
+	if _, err := OpenFrozenLsh(path); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for the serialization format, got %v", err)
+	}
+	path = writeFrozenFile(t, func(f *os.File) error {
+		_, err := lsh.WriteFrozen(f)
+		return err
+	})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-100], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFrozenLsh(path); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for a truncated file, got %v", err)
+	}
+}
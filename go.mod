@@ -0,0 +1,3 @@
+module github.com/ekzhu/lsh
+
+go 1.24
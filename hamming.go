@@ -0,0 +1,81 @@
+package lsh
+
+import (
+	"math/bits"
+)
+
+// BinaryPoint is a binary code in the Hamming space, packed
+// 64 bits per word with bit i stored in word i/64 at position i%64.
+type BinaryPoint []uint64
+
+// Bit returns the i-th bit of the code, either 0 or 1.
+func (p BinaryPoint) Bit(i int) int {
+	return int(p[i/64]>>uint(i%64)) & 1
+}
+
+// Hamming returns the Hamming distance of two binary codes, the
+// number of bits in which they differ.
+func (p BinaryPoint) Hamming(q BinaryPoint) int {
+	s := 0
+	for i := 0; i < len(p); i++ {
+		s += bits.OnesCount64(p[i] ^ q[i])
+	}
+	return s
+}
+
+// bitSamplingParams is the family of bit sampling LSH functions by
+// Piotr Indyk and Rajeev Motwani for Hamming distance. Each hash value
+// is a bit of the code at a randomly sampled position.
+type bitSamplingParams struct {
+	// Number of bits of the input codes.
+	dim int
+	// Number of hash tables.
+	l int
+	// Number of hash functions for each table.
+	m int
+
+	// Sampled bit positions for each (l, m).
+	positions [][]int
+}
+
+// NewHammingFamily creates the family of bit sampling LSH functions
+// for Hamming distance between BinaryPoints. Every hash value is a
+// bit, so the keys of the hash tables are m-bit samples of the code.
+// dim is the number of bits of the codes, l is the number of hash
+// tables to use, m is the number of bits to sample to form the key
+// to the hash tables.
+func NewHammingFamily(dim, l, m int, opts ...Option) Family[BinaryPoint] {
+	positions := make([][]int, l)
+	random := newConfig(opts).rand()
+	for i := range positions {
+		positions[i] = make([]int, m)
+		for j := range positions[i] {
+			positions[i][j] = random.Intn(dim)
+		}
+	}
+	return &bitSamplingParams{
+		dim:       dim,
+		l:         l,
+		m:         m,
+		positions: positions,
+	}
+}
+
+func (bs *bitSamplingParams) Dim() int       { return bs.dim }
+func (bs *bitSamplingParams) NumTables() int { return bs.l }
+func (bs *bitSamplingParams) NumHashes() int { return bs.m }
+func (bs *bitSamplingParams) bitHashes()     {}
+
+// Distance returns the Hamming distance between p and q.
+func (bs *bitSamplingParams) Distance(p, q BinaryPoint) float64 {
+	return float64(p.Hamming(q))
+}
+
+// Hash returns the sampled bits of point for the i-th hash table.
+func (bs *bitSamplingParams) Hash(point BinaryPoint, i int) []int {
+	s := make(hashTableKey, bs.m)
+	for j, pos := range bs.positions[i] {
+		s[j] = point.Bit(pos)
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package lsh
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// randomBinaryPoints returns a slice of random binary codes
+// of dim bits each.
+func randomBinaryPoints(n, dim int) []BinaryPoint {
+	random := rand.New(rand.NewSource(1))
+	points := make([]BinaryPoint, n)
+	for i := range points {
+		points[i] = make(BinaryPoint, (dim+63)/64)
+		for w := range points[i] {
+			points[i][w] = random.Uint64()
+		}
+	}
+	return points
+}
+
+// flipBits returns a copy of p with the first n bits flipped.
+func flipBits(p BinaryPoint, n int) BinaryPoint {
+	q := make(BinaryPoint, len(p))
+	copy(q, p)
+	for i := 0; i < n; i++ {
+		q[i/64] ^= 1 << uint(i%64)
+	}
+	return q
+}
+
+func Test_Hamming(t *testing.T) {
+	p := BinaryPoint{0xff, 0x1}
+	if d := p.Hamming(p); d != 0 {
+		t.Errorf("Hamming to itself should be 0, got %d", d)
+	}
+	if d := p.Hamming(BinaryPoint{0x0f, 0x0}); d != 5 {
+		t.Errorf("Expected Hamming distance 5, got %d", d)
+	}
+	if p.Bit(0) != 1 || p.Bit(8) != 0 || p.Bit(64) != 1 || p.Bit(65) != 0 {
+		t.Error("Bit fail")
+	}
+}
+
+func Test_HammingQuery(t *testing.T) {
+	points := randomBinaryPoints(10, 256)
+	basic := NewBasicLshWithFamily(NewHammingFamily(256, 5, 16))
+	forest := NewLshForestWithFamily(NewHammingFamily(256, 5, 16))
+	multiprobe := NewMultiprobeLshWithFamily(NewHammingFamily(256, 5, 16), 16)
+	for i, p := range points {
+		basic.Insert(p, strconv.Itoa(i))
+		forest.Insert(p, strconv.Itoa(i))
+		multiprobe.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		key := strconv.Itoa(i)
+		q := flipBits(p, 2)
+		if ids := forest.Query(q, 1); len(ids) != 1 || ids[0] != key {
+			t.Errorf("LshForest query fail: expected [%s], got %v", key, ids)
+		}
+		found := false
+		for _, id := range multiprobe.Query(q) {
+			if id == key {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("MultiprobeLsh query fail")
+		}
+		found = false
+		for _, id := range basic.Query(p) {
+			if id == key {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("BasicLsh query fail")
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package lsh
+
+import (
+	"encoding/binary"
+)
+
+// ID is the type of the unique identifiers of the points in an index,
+// a string or an integer. Integer ids take less memory than strings
+// and are compared faster.
+type ID interface {
+	string | int | int32 | int64 | uint | uint32 | uint64
+}
+
+// Kinds of ids in the binary format.
+const (
+	idString = iota
+	idInt
+	idInt32
+	idInt64
+	idUint
+	idUint32
+	idUint64
+)
+
+var idKindNames = map[int]string{
+	idString: "string",
+	idInt:    "int",
+	idInt32:  "int32",
+	idInt64:  "int64",
+	idUint:   "uint",
+	idUint32: "uint32",
+	idUint64: "uint64",
+}
+
+// idKind returns the kind of the ids of type K.
+func idKind[K ID]() int {
+	var id K
+	switch any(id).(type) {
+	case int:
+		return idInt
+	case int32:
+		return idInt32
+	case int64:
+		return idInt64
+	case uint:
+		return idUint
+	case uint32:
+		return idUint32
+	case uint64:
+		return idUint64
+	}
+	return idString
+}
+
+// idBits returns the 64 bits of an integer id, sign extended.
+func idBits[K ID](id K) uint64 {
+	switch id := any(id).(type) {
+	case int:
+		return uint64(id)
+	case int32:
+		return uint64(id)
+	case int64:
+		return uint64(id)
+	case uint:
+		return uint64(id)
+	case uint32:
+		return uint64(id)
+	case uint64:
+		return id
+	}
+	panic("string id")
+}
+
+// idFromBits returns the integer id of type K with the 64 bits v, and
+// whether v is in the range of K.
+func idFromBits[K ID](v uint64) (K, bool) {
+	var id K
+	switch p := any(&id).(type) {
+	case *int:
+		*p = int(v)
+	case *int32:
+		*p = int32(v)
+	case *int64:
+		*p = int64(v)
+	case *uint:
+		*p = uint(v)
+	case *uint32:
+		*p = uint32(v)
+	case *uint64:
+		*p = v
+	}
+	return id, idBits(id) == v
+}
+
+// appendID appends the bytes of id to b: the string itself, or the 8
+// bytes of an integer in little endian.
+func appendID[K ID](b []byte, id K) []byte {
+	if s, ok := any(id).(string); ok {
+		return append(b, s...)
+	}
+	return binary.LittleEndian.AppendUint64(b, idBits(id))
+}
+
+// parseID returns the id with the bytes b appended by appendID, and
+// whether they are valid.
+func parseID[K ID](b []byte) (K, bool) {
+	var id K
+	if p, ok := any(&id).(*string); ok {
+		*p = string(b)
+		return id, true
+	}
+	if len(b) != 8 {
+		return id, false
+	}
+	return idFromBits[K](binary.LittleEndian.Uint64(b))
+}
+
+func encodeID[K ID](enc *encoder, id K) {
+	if s, ok := any(id).(string); ok {
+		enc.string(s)
+		return
+	}
+	enc.uint64(idBits(id))
+}
+
+func encodeIDs[K ID](enc *encoder, ids []K) {
+	enc.int(len(ids))
+	for _, id := range ids {
+		encodeID(enc, id)
+	}
+}
+
+func decodeID[K ID](dec *decoder) K {
+	var id K
+	if p, ok := any(&id).(*string); ok {
+		*p = dec.string()
+		return id
+	}
+	v := dec.uint64()
+	id, ok := idFromBits[K](v)
+	if dec.err == nil && !ok {
+		dec.fail("id %d out of range for %s", v, idKindNames[idKind[K]()])
+	}
+	return id
+}
+
+func decodeIDs[K ID](dec *decoder) []K {
+	n := dec.length()
+	v := make([]K, 0, min(n, maxChunk))
+	for len(v) < n && dec.err == nil {
+		v = append(v, decodeID[K](dec))
+	}
+	return v
+}
@@ -0,0 +1,94 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func Test_IntegerIDs(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	family := NewL2Family(20, 5, 3, 10.0)
+	basic := NewBasicIndexOf[uint64](family, WithVectors())
+	forest := NewForestIndexOf[int32](family)
+	multiprobe := NewMultiprobeIndexOf[uint32](family, 8)
+	strs := NewBasicLshWithFamily(family, WithVectors())
+	strForest := NewLshForestWithFamily(family)
+	for i, p := range points {
+		basic.Insert(p, uint64(i)<<40)
+		forest.Insert(p, int32(-i))
+		multiprobe.Insert(p, uint32(i))
+		strs.Insert(p, string(rune('a'+i)))
+		strForest.Insert(p, string(rune('a'+i)))
+	}
+	// The candidates do not depend on the type of the ids.
+	for i, p := range points {
+		if want, got := len(strs.Query(p)), len(basic.Query(p)); got != want {
+			t.Errorf("Expected %d candidates, got %d", want, got)
+		}
+		if want, got := len(strForest.Query(p, 5)), len(forest.Query(p, 5)); got != want {
+			t.Errorf("Expected %d forest candidates, got %d", want, got)
+		}
+		if !slices.Contains(multiprobe.Query(p), uint32(i)) {
+			t.Errorf("Multiprobe query should contain %d", i)
+		}
+	}
+	if knn := basic.QueryKNN(points[3], 1); len(knn) != 1 || knn[0].ID != 3<<40 {
+		t.Errorf("Expected the query point as nearest neighbour, got %v", knn)
+	}
+	if err := basic.Delete(3 << 40); err != nil {
+		t.Error(err)
+	}
+	if err := basic.Delete(3 << 40); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := basic.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(BasicIndexOf[Point, uint64])
+	if _, err := loaded.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedQuery(points, basic.Query), sortedQuery(points, loaded.Query)) {
+		t.Error("Loaded index should return the same candidates")
+	}
+	if _, err := new(BasicIndexOf[Point, int64]).ReadFrom(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for another id type, got %v", err)
+	}
+
+	path := writeFrozenFile(t, func(f *os.File) error {
+		_, err := multiprobe.WriteFrozen(f)
+		return err
+	})
+	frozen, err := OpenFrozenIndexOf[uint32, Point](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frozen.Close()
+	if !reflect.DeepEqual(sortedQuery(points, multiprobe.Query), sortedQuery(points, frozen.Query)) {
+		t.Error("Frozen index should return the same candidates")
+	}
+	if _, err := OpenFrozenLsh(path); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for another id type, got %v", err)
+	}
+}
+
+func Test_IDBits(t *testing.T) {
+	if id, ok := idFromBits[int32](idBits(int32(-5))); !ok || id != -5 {
+		t.Errorf("Expected -5, got %d", id)
+	}
+	if _, ok := idFromBits[uint32](1 << 32); ok {
+		t.Error("1<<32 should be out of range for uint32")
+	}
+	if _, ok := idFromBits[uint64](idBits(int64(-1))); !ok {
+		t.Error("All bits should be in range for uint64")
+	}
+	if _, ok := parseID[int64](make([]byte, 4)); ok {
+		t.Error("4 bytes should not parse as an integer id")
+	}
+}
@@ -0,0 +1,111 @@
+package lsh
+
+import "fmt"
+
+// The dot product and squared L2 distance are computed by kernels
+// selected at startup: SIMD assembly where the CPU supports it (AVX2
+// and FMA on amd64, NEON on arm64), or the pure Go loops otherwise and
+// when built with the purego tag. The SIMD kernels sum in a different
+// order than the loops, so the results can differ in the last bits, and
+// points on the boundary of a hash bucket can be hashed differently on
+// machines using different kernels. The float32 kernels also sum in
+// float32.
+
+var (
+	// dotKernel returns the dot product of a and b of the same length.
+	dotKernel = dotGeneric[float64]
+	// l2Kernel returns the squared L2 distance of a and b of the same
+	// length.
+	l2Kernel = l2Generic[float64]
+	// dotKernel32 and l2Kernel32 are the kernels for float32.
+	dotKernel32 = dotGeneric[float32]
+	l2Kernel32  = l2Generic[float32]
+	// dot2x4Kernel stores in out the dot products of x0 and then x1
+	// with the four rows of a with len(x0) columns, each summed in the
+	// same order as dotKernel. It is nil with the pure Go kernels,
+	// whose order dot2x4 keeps.
+	dot2x4Kernel func(x0, x1, a []float64, out *[8]float64)
+	// dot2x4Kernel32 is dot2x4Kernel for float32.
+	dot2x4Kernel32 func(x0, x1, a []float32, out *[8]float32)
+)
+
+func dotGeneric[F Float](a, b []F) F {
+	b = b[:len(a)]
+	var s F
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func l2Generic[F Float](a, b []F) F {
+	b = b[:len(a)]
+	var s F
+	for i := range a {
+		d := a[i] - b[i]
+		s += d * d
+	}
+	return s
+}
+
+// dot returns the dot product of a and b of the same length using the
+// kernel for F.
+func dot[F Float](a, b []F) float64 {
+	switch a := any(a).(type) {
+	case []float64:
+		return dotKernel(a, any(b).([]float64))
+	case []float32:
+		return float64(dotKernel32(a, any(b).([]float32)))
+	}
+	panic("unreachable")
+}
+
+// dot2x4Rows returns the dot products of x0 and then x1 with the four
+// rows of a with len(x0) columns, each equal to the one returned by
+// dot.
+func dot2x4Rows[F Float](x0, x1, a []F) (s [8]float64) {
+	n := len(x0)
+	x1, a = x1[:n], a[:4*n]
+	switch x0 := any(x0).(type) {
+	case []float64:
+		if dot2x4Kernel != nil {
+			dot2x4Kernel(x0, any(x1).([]float64), any(a).([]float64), &s)
+			return s
+		}
+	case []float32:
+		if dot2x4Kernel32 != nil {
+			var s32 [8]float32
+			dot2x4Kernel32(x0, any(x1).([]float32), any(a).([]float32), &s32)
+			for i := range s {
+				s[i] = float64(s32[i])
+			}
+			return s
+		}
+	}
+	s00, s01, s02, s03, s10, s11, s12, s13 := dot2x4(x0, x1, a[:n], a[n:2*n], a[2*n:3*n], a[3*n:])
+	return [8]float64{
+		float64(s00), float64(s01), float64(s02), float64(s03),
+		float64(s10), float64(s11), float64(s12), float64(s13),
+	}
+}
+
+// l2Squared returns the squared L2 distance of a and b of the same
+// length using the kernel for F.
+func l2Squared[F Float](a, b []F) float64 {
+	switch a := any(a).(type) {
+	case []float64:
+		return l2Kernel(a, any(b).([]float64))
+	case []float32:
+		return float64(l2Kernel32(a, any(b).([]float32)))
+	}
+	panic("unreachable")
+}
+
+// truncate returns the first n elements of q, and panics if q is
+// shorter, as the kernels read n elements of their second argument.
+func truncate[F Float](q Vector[F], n int) Vector[F] {
+	if len(q) < n {
+		panic(fmt.Sprintf("lsh: point of dimension %d, expected at least %d", len(q), n))
+	}
+	return q[:n]
+}
@@ -0,0 +1,61 @@
+//go:build !purego
+
+package lsh
+
+func init() {
+	if hasAVX2FMA() {
+		dotKernel = dotAVX2
+		l2Kernel = l2AVX2
+		dotKernel32 = dot32AVX2
+		l2Kernel32 = l232AVX2
+		dot2x4Kernel = dot2x4AVX2
+		dot2x4Kernel32 = dot2x432AVX2
+	}
+}
+
+// hasAVX2FMA returns whether the CPU supports AVX2 and FMA, and the
+// operating system saves the AVX registers.
+func hasAVX2FMA() bool {
+	maxLeaf, _, _, _ := cpuid(0, 0)
+	if maxLeaf < 7 {
+		return false
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	const (
+		fma     = 1 << 12
+		osxsave = 1 << 27
+		avx     = 1 << 28
+	)
+	if ecx1&(fma|osxsave|avx) != fma|osxsave|avx {
+		return false
+	}
+	// The XMM and YMM states must be enabled in XCR0.
+	if xcr0, _ := xgetbv(); xcr0&6 != 6 {
+		return false
+	}
+	_, ebx7, _, _ := cpuid(7, 0)
+	const avx2 = 1 << 5
+	return ebx7&avx2 != 0
+}
+
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+func xgetbv() (eax, edx uint32)
+
+//go:noescape
+func dotAVX2(a, b []float64) float64
+
+//go:noescape
+func l2AVX2(a, b []float64) float64
+
+//go:noescape
+func dot32AVX2(a, b []float32) float32
+
+//go:noescape
+func l232AVX2(a, b []float32) float32
+
+//go:noescape
+func dot2x4AVX2(x0, x1, a []float64, out *[8]float64)
+
+//go:noescape
+func dot2x432AVX2(x0, x1, a []float32, out *[8]float32)
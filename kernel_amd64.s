@@ -0,0 +1,547 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+// func dotAVX2(a, b []float64) float64
+TEXT ·dotAVX2(SB), NOSPLIT, $0-56
+	MOVQ a_base+0(FP), SI
+	MOVQ a_len+8(FP), CX
+	MOVQ b_base+24(FP), DI
+	VXORPD Y0, Y0, Y0
+	VXORPD Y1, Y1, Y1
+	VXORPD Y2, Y2, Y2
+	VXORPD Y3, Y3, Y3
+	XORQ AX, AX
+
+	// 16 elements at a time, in four independent accumulators.
+	MOVQ CX, BX
+	ANDQ $~15, BX
+
+dotloop16:
+	CMPQ AX, BX
+	JGE dotloop4start
+	VMOVUPD (SI)(AX*8), Y4
+	VMOVUPD 32(SI)(AX*8), Y5
+	VMOVUPD 64(SI)(AX*8), Y6
+	VMOVUPD 96(SI)(AX*8), Y7
+	VFMADD231PD (DI)(AX*8), Y4, Y0
+	VFMADD231PD 32(DI)(AX*8), Y5, Y1
+	VFMADD231PD 64(DI)(AX*8), Y6, Y2
+	VFMADD231PD 96(DI)(AX*8), Y7, Y3
+	ADDQ $16, AX
+	JMP dotloop16
+
+dotloop4start:
+	MOVQ CX, BX
+	ANDQ $~3, BX
+
+dotloop4:
+	CMPQ AX, BX
+	JGE dotreduce
+	VMOVUPD (SI)(AX*8), Y4
+	VFMADD231PD (DI)(AX*8), Y4, Y0
+	ADDQ $4, AX
+	JMP dotloop4
+
+dotreduce:
+	VADDPD Y1, Y0, Y0
+	VADDPD Y3, Y2, Y2
+	VADDPD Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPD X1, X0, X0
+	VHADDPD X0, X0, X0
+
+dotloop1:
+	CMPQ AX, CX
+	JGE dotdone
+	VMOVSD (SI)(AX*8), X4
+	VFMADD231SD (DI)(AX*8), X4, X0
+	INCQ AX
+	JMP dotloop1
+
+dotdone:
+	VZEROUPPER
+	MOVSD X0, ret+48(FP)
+	RET
+
+// func l2AVX2(a, b []float64) float64
+TEXT ·l2AVX2(SB), NOSPLIT, $0-56
+	MOVQ a_base+0(FP), SI
+	MOVQ a_len+8(FP), CX
+	MOVQ b_base+24(FP), DI
+	VXORPD Y0, Y0, Y0
+	VXORPD Y1, Y1, Y1
+	VXORPD Y2, Y2, Y2
+	VXORPD Y3, Y3, Y3
+	XORQ AX, AX
+
+	// 16 elements at a time, in four independent accumulators.
+	MOVQ CX, BX
+	ANDQ $~15, BX
+
+l2loop16:
+	CMPQ AX, BX
+	JGE l2loop4start
+	VMOVUPD (SI)(AX*8), Y4
+	VMOVUPD 32(SI)(AX*8), Y5
+	VMOVUPD 64(SI)(AX*8), Y6
+	VMOVUPD 96(SI)(AX*8), Y7
+	VSUBPD (DI)(AX*8), Y4, Y4
+	VSUBPD 32(DI)(AX*8), Y5, Y5
+	VSUBPD 64(DI)(AX*8), Y6, Y6
+	VSUBPD 96(DI)(AX*8), Y7, Y7
+	VFMADD231PD Y4, Y4, Y0
+	VFMADD231PD Y5, Y5, Y1
+	VFMADD231PD Y6, Y6, Y2
+	VFMADD231PD Y7, Y7, Y3
+	ADDQ $16, AX
+	JMP l2loop16
+
+l2loop4start:
+	MOVQ CX, BX
+	ANDQ $~3, BX
+
+l2loop4:
+	CMPQ AX, BX
+	JGE l2reduce
+	VMOVUPD (SI)(AX*8), Y4
+	VSUBPD (DI)(AX*8), Y4, Y4
+	VFMADD231PD Y4, Y4, Y0
+	ADDQ $4, AX
+	JMP l2loop4
+
+l2reduce:
+	VADDPD Y1, Y0, Y0
+	VADDPD Y3, Y2, Y2
+	VADDPD Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPD X1, X0, X0
+	VHADDPD X0, X0, X0
+
+l2loop1:
+	CMPQ AX, CX
+	JGE l2done
+	VMOVSD (SI)(AX*8), X4
+	VSUBSD (DI)(AX*8), X4, X4
+	VFMADD231SD X4, X4, X0
+	INCQ AX
+	JMP l2loop1
+
+l2done:
+	VZEROUPPER
+	MOVSD X0, ret+48(FP)
+	RET
+
+// func dot32AVX2(a, b []float32) float32
+TEXT ·dot32AVX2(SB), NOSPLIT, $0-52
+	MOVQ a_base+0(FP), SI
+	MOVQ a_len+8(FP), CX
+	MOVQ b_base+24(FP), DI
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+	XORQ AX, AX
+
+	// 32 elements at a time, in four independent accumulators.
+	MOVQ CX, BX
+	ANDQ $~31, BX
+
+dot32loop32:
+	CMPQ AX, BX
+	JGE dot32loop8start
+	VMOVUPS (SI)(AX*4), Y4
+	VMOVUPS 32(SI)(AX*4), Y5
+	VMOVUPS 64(SI)(AX*4), Y6
+	VMOVUPS 96(SI)(AX*4), Y7
+	VFMADD231PS (DI)(AX*4), Y4, Y0
+	VFMADD231PS 32(DI)(AX*4), Y5, Y1
+	VFMADD231PS 64(DI)(AX*4), Y6, Y2
+	VFMADD231PS 96(DI)(AX*4), Y7, Y3
+	ADDQ $32, AX
+	JMP dot32loop32
+
+dot32loop8start:
+	MOVQ CX, BX
+	ANDQ $~7, BX
+
+dot32loop8:
+	CMPQ AX, BX
+	JGE dot32reduce
+	VMOVUPS (SI)(AX*4), Y4
+	VFMADD231PS (DI)(AX*4), Y4, Y0
+	ADDQ $8, AX
+	JMP dot32loop8
+
+dot32reduce:
+	VADDPS Y1, Y0, Y0
+	VADDPS Y3, Y2, Y2
+	VADDPS Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPS X1, X0, X0
+	VHADDPS X0, X0, X0
+	VHADDPS X0, X0, X0
+
+dot32loop1:
+	CMPQ AX, CX
+	JGE dot32done
+	VMOVSS (SI)(AX*4), X4
+	VFMADD231SS (DI)(AX*4), X4, X0
+	INCQ AX
+	JMP dot32loop1
+
+dot32done:
+	VZEROUPPER
+	MOVSS X0, ret+48(FP)
+	RET
+
+// func l232AVX2(a, b []float32) float32
+TEXT ·l232AVX2(SB), NOSPLIT, $0-52
+	MOVQ a_base+0(FP), SI
+	MOVQ a_len+8(FP), CX
+	MOVQ b_base+24(FP), DI
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+	XORQ AX, AX
+
+	// 32 elements at a time, in four independent accumulators.
+	MOVQ CX, BX
+	ANDQ $~31, BX
+
+l232loop32:
+	CMPQ AX, BX
+	JGE l232loop8start
+	VMOVUPS (SI)(AX*4), Y4
+	VMOVUPS 32(SI)(AX*4), Y5
+	VMOVUPS 64(SI)(AX*4), Y6
+	VMOVUPS 96(SI)(AX*4), Y7
+	VSUBPS (DI)(AX*4), Y4, Y4
+	VSUBPS 32(DI)(AX*4), Y5, Y5
+	VSUBPS 64(DI)(AX*4), Y6, Y6
+	VSUBPS 96(DI)(AX*4), Y7, Y7
+	VFMADD231PS Y4, Y4, Y0
+	VFMADD231PS Y5, Y5, Y1
+	VFMADD231PS Y6, Y6, Y2
+	VFMADD231PS Y7, Y7, Y3
+	ADDQ $32, AX
+	JMP l232loop32
+
+l232loop8start:
+	MOVQ CX, BX
+	ANDQ $~7, BX
+
+l232loop8:
+	CMPQ AX, BX
+	JGE l232reduce
+	VMOVUPS (SI)(AX*4), Y4
+	VSUBPS (DI)(AX*4), Y4, Y4
+	VFMADD231PS Y4, Y4, Y0
+	ADDQ $8, AX
+	JMP l232loop8
+
+l232reduce:
+	VADDPS Y1, Y0, Y0
+	VADDPS Y3, Y2, Y2
+	VADDPS Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPS X1, X0, X0
+	VHADDPS X0, X0, X0
+	VHADDPS X0, X0, X0
+
+l232loop1:
+	CMPQ AX, CX
+	JGE l232done
+	VMOVSS (SI)(AX*4), X4
+	VSUBSS (DI)(AX*4), X4, X4
+	VFMADD231SS X4, X4, X0
+	INCQ AX
+	JMP l232loop1
+
+l232done:
+	VZEROUPPER
+	MOVSS X0, ret+48(FP)
+	RET
+
+// DOT2X4PD adds the products of the 4 elements at byte offset off of
+// x0 (SI) and x1 (DI) with those of the rows a0 to a3 (R8 to R11) to
+// the accumulators Y0 to Y3 and Y4 to Y7.
+#define DOT2X4PD(off) \
+	VMOVUPD (SI)(off*1), Y8; \
+	VMOVUPD (DI)(off*1), Y9; \
+	VMOVUPD (R8)(off*1), Y10; \
+	VFMADD231PD Y10, Y8, Y0; \
+	VFMADD231PD Y10, Y9, Y4; \
+	VMOVUPD (R9)(off*1), Y11; \
+	VFMADD231PD Y11, Y8, Y1; \
+	VFMADD231PD Y11, Y9, Y5; \
+	VMOVUPD (R10)(off*1), Y12; \
+	VFMADD231PD Y12, Y8, Y2; \
+	VFMADD231PD Y12, Y9, Y6; \
+	VMOVUPD (R11)(off*1), Y13; \
+	VFMADD231PD Y13, Y8, Y3; \
+	VFMADD231PD Y13, Y9, Y7
+
+// func dot2x4AVX2(x0, x1, a []float64, out *[8]float64)
+//
+// Each dot product is summed in the same order as dotAVX2: the four
+// accumulators of dotAVX2 are independent until they are reduced, so
+// they are computed in four passes over the 16 element blocks, for the
+// eight dot products at a time, and spilled to acc.
+TEXT ·dot2x4AVX2(SB), $1024-80
+	MOVQ x0_base+0(FP), SI
+	MOVQ x0_len+8(FP), CX
+	MOVQ x1_base+24(FP), DI
+	MOVQ a_base+48(FP), R8
+	MOVQ out+72(FP), DX
+	SHLQ $3, CX
+	LEAQ (R8)(CX*1), R9
+	LEAQ (R9)(CX*1), R10
+	LEAQ (R10)(CX*1), R11
+	// Byte offsets of the end of the 16 and 4 element blocks.
+	MOVQ CX, BX
+	ANDQ $~127, BX
+	MOVQ CX, R14
+	ANDQ $~31, R14
+	LEAQ acc-1024(SP), AX
+	// Byte offset of the accumulator of the pass in a block.
+	XORQ R12, R12
+
+dot2x4pass:
+	VXORPD Y0, Y0, Y0
+	VXORPD Y1, Y1, Y1
+	VXORPD Y2, Y2, Y2
+	VXORPD Y3, Y3, Y3
+	VXORPD Y4, Y4, Y4
+	VXORPD Y5, Y5, Y5
+	VXORPD Y6, Y6, Y6
+	VXORPD Y7, Y7, Y7
+	MOVQ R12, R13
+
+dot2x4loop16:
+	CMPQ R13, BX
+	JGE dot2x4loop4start
+	DOT2X4PD(R13)
+	ADDQ $128, R13
+	JMP dot2x4loop16
+
+dot2x4loop4start:
+	// The first accumulator also sums the remaining 4 element blocks.
+	TESTQ R12, R12
+	JNZ dot2x4store
+
+dot2x4loop4:
+	CMPQ R13, R14
+	JGE dot2x4store
+	DOT2X4PD(R13)
+	ADDQ $32, R13
+	JMP dot2x4loop4
+
+dot2x4store:
+	VMOVUPD Y0, 0(AX)
+	VMOVUPD Y1, 32(AX)
+	VMOVUPD Y2, 64(AX)
+	VMOVUPD Y3, 96(AX)
+	VMOVUPD Y4, 128(AX)
+	VMOVUPD Y5, 160(AX)
+	VMOVUPD Y6, 192(AX)
+	VMOVUPD Y7, 224(AX)
+	ADDQ $256, AX
+	ADDQ $32, R12
+	CMPQ R12, $128
+	JL dot2x4pass
+
+	// Reduce the accumulators of each dot product like dotAVX2, with x
+	// in R12 and the row in R9.
+	LEAQ acc-1024(SP), AX
+	MOVQ SI, R12
+	MOVQ R8, R9
+	XORQ R10, R10
+
+dot2x4reduce:
+	VMOVUPD 0(AX), Y0
+	VMOVUPD 256(AX), Y1
+	VMOVUPD 512(AX), Y2
+	VMOVUPD 768(AX), Y3
+	VADDPD Y1, Y0, Y0
+	VADDPD Y3, Y2, Y2
+	VADDPD Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPD X1, X0, X0
+	VHADDPD X0, X0, X0
+	MOVQ R14, R13
+
+dot2x4loop1:
+	CMPQ R13, CX
+	JGE dot2x4next
+	VMOVSD (R12)(R13*1), X4
+	VFMADD231SD (R9)(R13*1), X4, X0
+	ADDQ $8, R13
+	JMP dot2x4loop1
+
+dot2x4next:
+	VMOVSD X0, (DX)
+	ADDQ $8, DX
+	ADDQ $32, AX
+	ADDQ CX, R9
+	INCQ R10
+	CMPQ R10, $4
+	JNE dot2x4nextrow
+	MOVQ DI, R12
+	MOVQ R8, R9
+
+dot2x4nextrow:
+	CMPQ R10, $8
+	JL dot2x4reduce
+	VZEROUPPER
+	RET
+
+// DOT2X4PS is DOT2X4PD for 8 float32 elements.
+#define DOT2X4PS(off) \
+	VMOVUPS (SI)(off*1), Y8; \
+	VMOVUPS (DI)(off*1), Y9; \
+	VMOVUPS (R8)(off*1), Y10; \
+	VFMADD231PS Y10, Y8, Y0; \
+	VFMADD231PS Y10, Y9, Y4; \
+	VMOVUPS (R9)(off*1), Y11; \
+	VFMADD231PS Y11, Y8, Y1; \
+	VFMADD231PS Y11, Y9, Y5; \
+	VMOVUPS (R10)(off*1), Y12; \
+	VFMADD231PS Y12, Y8, Y2; \
+	VFMADD231PS Y12, Y9, Y6; \
+	VMOVUPS (R11)(off*1), Y13; \
+	VFMADD231PS Y13, Y8, Y3; \
+	VFMADD231PS Y13, Y9, Y7
+
+// func dot2x432AVX2(x0, x1, a []float32, out *[8]float32)
+//
+// Each dot product is summed in the same order as dot32AVX2, like
+// dot2x4AVX2.
+TEXT ·dot2x432AVX2(SB), $1024-80
+	MOVQ x0_base+0(FP), SI
+	MOVQ x0_len+8(FP), CX
+	MOVQ x1_base+24(FP), DI
+	MOVQ a_base+48(FP), R8
+	MOVQ out+72(FP), DX
+	SHLQ $2, CX
+	LEAQ (R8)(CX*1), R9
+	LEAQ (R9)(CX*1), R10
+	LEAQ (R10)(CX*1), R11
+	// Byte offsets of the end of the 32 and 8 element blocks.
+	MOVQ CX, BX
+	ANDQ $~127, BX
+	MOVQ CX, R14
+	ANDQ $~31, R14
+	LEAQ acc-1024(SP), AX
+	// Byte offset of the accumulator of the pass in a block.
+	XORQ R12, R12
+
+dot2x432pass:
+	VXORPS Y0, Y0, Y0
+	VXORPS Y1, Y1, Y1
+	VXORPS Y2, Y2, Y2
+	VXORPS Y3, Y3, Y3
+	VXORPS Y4, Y4, Y4
+	VXORPS Y5, Y5, Y5
+	VXORPS Y6, Y6, Y6
+	VXORPS Y7, Y7, Y7
+	MOVQ R12, R13
+
+dot2x432loop32:
+	CMPQ R13, BX
+	JGE dot2x432loop8start
+	DOT2X4PS(R13)
+	ADDQ $128, R13
+	JMP dot2x432loop32
+
+dot2x432loop8start:
+	// The first accumulator also sums the remaining 8 element blocks.
+	TESTQ R12, R12
+	JNZ dot2x432store
+
+dot2x432loop8:
+	CMPQ R13, R14
+	JGE dot2x432store
+	DOT2X4PS(R13)
+	ADDQ $32, R13
+	JMP dot2x432loop8
+
+dot2x432store:
+	VMOVUPS Y0, 0(AX)
+	VMOVUPS Y1, 32(AX)
+	VMOVUPS Y2, 64(AX)
+	VMOVUPS Y3, 96(AX)
+	VMOVUPS Y4, 128(AX)
+	VMOVUPS Y5, 160(AX)
+	VMOVUPS Y6, 192(AX)
+	VMOVUPS Y7, 224(AX)
+	ADDQ $256, AX
+	ADDQ $32, R12
+	CMPQ R12, $128
+	JL dot2x432pass
+
+	// Reduce the accumulators of each dot product like dot32AVX2, with
+	// x in R12 and the row in R9.
+	LEAQ acc-1024(SP), AX
+	MOVQ SI, R12
+	MOVQ R8, R9
+	XORQ R10, R10
+
+dot2x432reduce:
+	VMOVUPS 0(AX), Y0
+	VMOVUPS 256(AX), Y1
+	VMOVUPS 512(AX), Y2
+	VMOVUPS 768(AX), Y3
+	VADDPS Y1, Y0, Y0
+	VADDPS Y3, Y2, Y2
+	VADDPS Y2, Y0, Y0
+	VEXTRACTF128 $1, Y0, X1
+	VADDPS X1, X0, X0
+	VHADDPS X0, X0, X0
+	VHADDPS X0, X0, X0
+	MOVQ R14, R13
+
+dot2x432loop1:
+	CMPQ R13, CX
+	JGE dot2x432next
+	VMOVSS (R12)(R13*1), X4
+	VFMADD231SS (R9)(R13*1), X4, X0
+	ADDQ $4, R13
+	JMP dot2x432loop1
+
+dot2x432next:
+	VMOVSS X0, (DX)
+	ADDQ $4, DX
+	ADDQ $32, AX
+	ADDQ CX, R9
+	INCQ R10
+	CMPQ R10, $4
+	JNE dot2x432nextrow
+	MOVQ DI, R12
+	MOVQ R8, R9
+
+dot2x432nextrow:
+	CMPQ R10, $8
+	JL dot2x432reduce
+	VZEROUPPER
+	RET
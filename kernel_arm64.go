@@ -0,0 +1,31 @@
+//go:build !purego
+
+package lsh
+
+// NEON is part of the base arm64 architecture, so it is always used.
+func init() {
+	dotKernel = dotNEON
+	l2Kernel = l2NEON
+	dotKernel32 = dot32NEON
+	l2Kernel32 = l232NEON
+	dot2x4Kernel = dot2x4NEON
+	dot2x4Kernel32 = dot2x432NEON
+}
+
+//go:noescape
+func dotNEON(a, b []float64) float64
+
+//go:noescape
+func l2NEON(a, b []float64) float64
+
+//go:noescape
+func dot32NEON(a, b []float32) float32
+
+//go:noescape
+func l232NEON(a, b []float32) float32
+
+//go:noescape
+func dot2x4NEON(x0, x1, a []float64, out *[8]float64)
+
+//go:noescape
+func dot2x432NEON(x0, x1, a []float32, out *[8]float32)
@@ -0,0 +1,410 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// func dotNEON(a, b []float64) float64
+TEXT ·dotNEON(SB), NOSPLIT, $0-56
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	VEOR V2.B16, V2.B16, V2.B16
+	VEOR V3.B16, V3.B16, V3.B16
+
+	// 8 elements at a time, in four independent accumulators.
+	AND $~7, R2, R3
+	CBZ R3, dotreduce
+
+dotloop8:
+	VLD1.P 64(R0), [V4.D2, V5.D2, V6.D2, V7.D2]
+	VLD1.P 64(R1), [V16.D2, V17.D2, V18.D2, V19.D2]
+	VFMLA V4.D2, V16.D2, V0.D2
+	VFMLA V5.D2, V17.D2, V1.D2
+	VFMLA V6.D2, V18.D2, V2.D2
+	VFMLA V7.D2, V19.D2, V3.D2
+	SUBS $8, R3, R3
+	BNE dotloop8
+
+dotreduce:
+	VFADD V1.D2, V0.D2, V0.D2
+	VFADD V3.D2, V2.D2, V2.D2
+	VFADD V2.D2, V0.D2, V0.D2
+	VFADDP V0.D2, V0.D2, V0.D2
+	AND $7, R2, R3
+	CBZ R3, dotdone
+
+dotloop1:
+	FMOVD.P 8(R0), F4
+	FMOVD.P 8(R1), F5
+	FMADDD F5, F0, F4, F0
+	SUBS $1, R3, R3
+	BNE dotloop1
+
+dotdone:
+	FMOVD F0, ret+48(FP)
+	RET
+
+// func l2NEON(a, b []float64) float64
+TEXT ·l2NEON(SB), NOSPLIT, $0-56
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	VEOR V2.B16, V2.B16, V2.B16
+	VEOR V3.B16, V3.B16, V3.B16
+
+	// 8 elements at a time, in four independent accumulators.
+	AND $~7, R2, R3
+	CBZ R3, l2reduce
+
+l2loop8:
+	VLD1.P 64(R0), [V4.D2, V5.D2, V6.D2, V7.D2]
+	VLD1.P 64(R1), [V16.D2, V17.D2, V18.D2, V19.D2]
+	VFSUB V16.D2, V4.D2, V4.D2
+	VFSUB V17.D2, V5.D2, V5.D2
+	VFSUB V18.D2, V6.D2, V6.D2
+	VFSUB V19.D2, V7.D2, V7.D2
+	VFMLA V4.D2, V4.D2, V0.D2
+	VFMLA V5.D2, V5.D2, V1.D2
+	VFMLA V6.D2, V6.D2, V2.D2
+	VFMLA V7.D2, V7.D2, V3.D2
+	SUBS $8, R3, R3
+	BNE l2loop8
+
+l2reduce:
+	VFADD V1.D2, V0.D2, V0.D2
+	VFADD V3.D2, V2.D2, V2.D2
+	VFADD V2.D2, V0.D2, V0.D2
+	VFADDP V0.D2, V0.D2, V0.D2
+	AND $7, R2, R3
+	CBZ R3, l2done
+
+l2loop1:
+	FMOVD.P 8(R0), F4
+	FMOVD.P 8(R1), F5
+	FSUBD F5, F4, F4
+	FMADDD F4, F0, F4, F0
+	SUBS $1, R3, R3
+	BNE l2loop1
+
+l2done:
+	FMOVD F0, ret+48(FP)
+	RET
+
+// func dot32NEON(a, b []float32) float32
+TEXT ·dot32NEON(SB), NOSPLIT, $0-52
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	VEOR V2.B16, V2.B16, V2.B16
+	VEOR V3.B16, V3.B16, V3.B16
+
+	// 16 elements at a time, in four independent accumulators.
+	AND $~15, R2, R3
+	CBZ R3, dot32reduce
+
+dot32loop16:
+	VLD1.P 64(R0), [V4.S4, V5.S4, V6.S4, V7.S4]
+	VLD1.P 64(R1), [V16.S4, V17.S4, V18.S4, V19.S4]
+	VFMLA V4.S4, V16.S4, V0.S4
+	VFMLA V5.S4, V17.S4, V1.S4
+	VFMLA V6.S4, V18.S4, V2.S4
+	VFMLA V7.S4, V19.S4, V3.S4
+	SUBS $16, R3, R3
+	BNE dot32loop16
+
+dot32reduce:
+	VFADD V1.S4, V0.S4, V0.S4
+	VFADD V3.S4, V2.S4, V2.S4
+	VFADD V2.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	AND $15, R2, R3
+	CBZ R3, dot32done
+
+dot32loop1:
+	FMOVS.P 4(R0), F4
+	FMOVS.P 4(R1), F5
+	FMADDS F5, F0, F4, F0
+	SUBS $1, R3, R3
+	BNE dot32loop1
+
+dot32done:
+	FMOVS F0, ret+48(FP)
+	RET
+
+// func l232NEON(a, b []float32) float32
+TEXT ·l232NEON(SB), NOSPLIT, $0-52
+	MOVD a_base+0(FP), R0
+	MOVD a_len+8(FP), R2
+	MOVD b_base+24(FP), R1
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	VEOR V2.B16, V2.B16, V2.B16
+	VEOR V3.B16, V3.B16, V3.B16
+
+	// 16 elements at a time, in four independent accumulators.
+	AND $~15, R2, R3
+	CBZ R3, l232reduce
+
+l232loop16:
+	VLD1.P 64(R0), [V4.S4, V5.S4, V6.S4, V7.S4]
+	VLD1.P 64(R1), [V16.S4, V17.S4, V18.S4, V19.S4]
+	VFSUB V16.S4, V4.S4, V4.S4
+	VFSUB V17.S4, V5.S4, V5.S4
+	VFSUB V18.S4, V6.S4, V6.S4
+	VFSUB V19.S4, V7.S4, V7.S4
+	VFMLA V4.S4, V4.S4, V0.S4
+	VFMLA V5.S4, V5.S4, V1.S4
+	VFMLA V6.S4, V6.S4, V2.S4
+	VFMLA V7.S4, V7.S4, V3.S4
+	SUBS $16, R3, R3
+	BNE l232loop16
+
+l232reduce:
+	VFADD V1.S4, V0.S4, V0.S4
+	VFADD V3.S4, V2.S4, V2.S4
+	VFADD V2.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	AND $15, R2, R3
+	CBZ R3, l232done
+
+l232loop1:
+	FMOVS.P 4(R0), F4
+	FMOVS.P 4(R1), F5
+	FSUBS F5, F4, F4
+	FMADDS F4, F0, F4, F0
+	SUBS $1, R3, R3
+	BNE l232loop1
+
+l232done:
+	FMOVS F0, ret+48(FP)
+	RET
+
+// func dot2x4NEON(x0, x1, a []float64, out *[8]float64)
+//
+// Each dot product is summed in the same order as dotNEON: the four
+// accumulators of dotNEON are independent until they are reduced, so
+// they are computed in four passes over the blocks, for the eight dot
+// products at a time, and spilled to acc.
+TEXT ·dot2x4NEON(SB), $512-80
+	MOVD x0_base+0(FP), R0
+	MOVD x0_len+8(FP), R2
+	MOVD x1_base+24(FP), R1
+	MOVD a_base+48(FP), R4
+	MOVD out+72(FP), R3
+	LSL $3, R2, R2
+	ADD R2, R4, R5
+	ADD R2, R5, R6
+	ADD R2, R6, R7
+	// Byte offset of the end of the 64 byte blocks.
+	AND $~63, R2, R8
+	MOVD $acc-512(SP), R9
+	MOVD $64, R21
+	// Byte offset of the accumulator of the pass in a block.
+	MOVD $0, R10
+
+dot2x4NEONpass:
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	VEOR V2.B16, V2.B16, V2.B16
+	VEOR V3.B16, V3.B16, V3.B16
+	VEOR V4.B16, V4.B16, V4.B16
+	VEOR V5.B16, V5.B16, V5.B16
+	VEOR V6.B16, V6.B16, V6.B16
+	VEOR V7.B16, V7.B16, V7.B16
+	ADD R10, R0, R11
+	ADD R10, R1, R12
+	ADD R10, R4, R13
+	ADD R10, R5, R14
+	ADD R10, R6, R15
+	ADD R10, R7, R19
+	MOVD R10, R20
+	CMP R8, R20
+	BGE dot2x4NEONstore
+
+dot2x4NEONloop:
+	VLD1.P (R11)(R21), [V16.D2]
+	VLD1.P (R12)(R21), [V17.D2]
+	VLD1.P (R13)(R21), [V18.D2]
+	VFMLA V16.D2, V18.D2, V0.D2
+	VFMLA V17.D2, V18.D2, V4.D2
+	VLD1.P (R14)(R21), [V19.D2]
+	VFMLA V16.D2, V19.D2, V1.D2
+	VFMLA V17.D2, V19.D2, V5.D2
+	VLD1.P (R15)(R21), [V20.D2]
+	VFMLA V16.D2, V20.D2, V2.D2
+	VFMLA V17.D2, V20.D2, V6.D2
+	VLD1.P (R19)(R21), [V21.D2]
+	VFMLA V16.D2, V21.D2, V3.D2
+	VFMLA V17.D2, V21.D2, V7.D2
+	ADD $64, R20
+	CMP R8, R20
+	BLT dot2x4NEONloop
+
+dot2x4NEONstore:
+	VST1.P [V0.D2, V1.D2, V2.D2, V3.D2], 64(R9)
+	VST1.P [V4.D2, V5.D2, V6.D2, V7.D2], 64(R9)
+	ADD $16, R10
+	CMP $64, R10
+	BLT dot2x4NEONpass
+
+	// Reduce the accumulators of each dot product like dotNEON, with x
+	// in R11 and the row in R13.
+	MOVD $acc-512(SP), R9
+	MOVD R0, R11
+	MOVD R4, R13
+	MOVD $0, R10
+
+dot2x4NEONreduce:
+	FMOVQ 0(R9), F0
+	FMOVQ 128(R9), F1
+	FMOVQ 256(R9), F2
+	FMOVQ 384(R9), F3
+	VFADD V1.D2, V0.D2, V0.D2
+	VFADD V3.D2, V2.D2, V2.D2
+	VFADD V2.D2, V0.D2, V0.D2
+	VFADDP V0.D2, V0.D2, V0.D2
+	SUBS R8, R2, R20
+	BEQ dot2x4NEONnext
+	ADD R8, R11, R14
+	ADD R8, R13, R15
+
+dot2x4NEONloop1:
+	FMOVD.P 8(R14), F4
+	FMOVD.P 8(R15), F5
+	FMADDD F5, F0, F4, F0
+	SUBS $8, R20, R20
+	BNE dot2x4NEONloop1
+
+dot2x4NEONnext:
+	FMOVD.P F0, 8(R3)
+	ADD $16, R9
+	ADD R2, R13
+	ADD $1, R10
+	CMP $4, R10
+	BNE dot2x4NEONnextrow
+	MOVD R1, R11
+	MOVD R4, R13
+
+dot2x4NEONnextrow:
+	CMP $8, R10
+	BLT dot2x4NEONreduce
+	RET
+
+// func dot2x432NEON(x0, x1, a []float32, out *[8]float32)
+//
+// Each dot product is summed in the same order as dot32NEON: the four
+// accumulators of dot32NEON are independent until they are reduced, so
+// they are computed in four passes over the blocks, for the eight dot
+// products at a time, and spilled to acc.
+TEXT ·dot2x432NEON(SB), $512-80
+	MOVD x0_base+0(FP), R0
+	MOVD x0_len+8(FP), R2
+	MOVD x1_base+24(FP), R1
+	MOVD a_base+48(FP), R4
+	MOVD out+72(FP), R3
+	LSL $2, R2, R2
+	ADD R2, R4, R5
+	ADD R2, R5, R6
+	ADD R2, R6, R7
+	// Byte offset of the end of the 64 byte blocks.
+	AND $~63, R2, R8
+	MOVD $acc-512(SP), R9
+	MOVD $64, R21
+	// Byte offset of the accumulator of the pass in a block.
+	MOVD $0, R10
+
+dot2x432NEONpass:
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	VEOR V2.B16, V2.B16, V2.B16
+	VEOR V3.B16, V3.B16, V3.B16
+	VEOR V4.B16, V4.B16, V4.B16
+	VEOR V5.B16, V5.B16, V5.B16
+	VEOR V6.B16, V6.B16, V6.B16
+	VEOR V7.B16, V7.B16, V7.B16
+	ADD R10, R0, R11
+	ADD R10, R1, R12
+	ADD R10, R4, R13
+	ADD R10, R5, R14
+	ADD R10, R6, R15
+	ADD R10, R7, R19
+	MOVD R10, R20
+	CMP R8, R20
+	BGE dot2x432NEONstore
+
+dot2x432NEONloop:
+	VLD1.P (R11)(R21), [V16.S4]
+	VLD1.P (R12)(R21), [V17.S4]
+	VLD1.P (R13)(R21), [V18.S4]
+	VFMLA V16.S4, V18.S4, V0.S4
+	VFMLA V17.S4, V18.S4, V4.S4
+	VLD1.P (R14)(R21), [V19.S4]
+	VFMLA V16.S4, V19.S4, V1.S4
+	VFMLA V17.S4, V19.S4, V5.S4
+	VLD1.P (R15)(R21), [V20.S4]
+	VFMLA V16.S4, V20.S4, V2.S4
+	VFMLA V17.S4, V20.S4, V6.S4
+	VLD1.P (R19)(R21), [V21.S4]
+	VFMLA V16.S4, V21.S4, V3.S4
+	VFMLA V17.S4, V21.S4, V7.S4
+	ADD $64, R20
+	CMP R8, R20
+	BLT dot2x432NEONloop
+
+dot2x432NEONstore:
+	VST1.P [V0.S4, V1.S4, V2.S4, V3.S4], 64(R9)
+	VST1.P [V4.S4, V5.S4, V6.S4, V7.S4], 64(R9)
+	ADD $16, R10
+	CMP $64, R10
+	BLT dot2x432NEONpass
+
+	// Reduce the accumulators of each dot product like dot32NEON, with x
+	// in R11 and the row in R13.
+	MOVD $acc-512(SP), R9
+	MOVD R0, R11
+	MOVD R4, R13
+	MOVD $0, R10
+
+dot2x432NEONreduce:
+	FMOVQ 0(R9), F0
+	FMOVQ 128(R9), F1
+	FMOVQ 256(R9), F2
+	FMOVQ 384(R9), F3
+	VFADD V1.S4, V0.S4, V0.S4
+	VFADD V3.S4, V2.S4, V2.S4
+	VFADD V2.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	VFADDP V0.S4, V0.S4, V0.S4
+	SUBS R8, R2, R20
+	BEQ dot2x432NEONnext
+	ADD R8, R11, R14
+	ADD R8, R13, R15
+
+dot2x432NEONloop1:
+	FMOVS.P 4(R14), F4
+	FMOVS.P 4(R15), F5
+	FMADDS F5, F0, F4, F0
+	SUBS $4, R20, R20
+	BNE dot2x432NEONloop1
+
+dot2x432NEONnext:
+	FMOVS.P F0, 4(R3)
+	ADD $16, R9
+	ADD R2, R13
+	ADD $1, R10
+	CMP $4, R10
+	BNE dot2x432NEONnextrow
+	MOVD R1, R11
+	MOVD R4, R13
+
+dot2x432NEONnextrow:
+	CMP $8, R10
+	BLT dot2x432NEONreduce
+	RET
@@ -0,0 +1,151 @@
+package lsh
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+func Test_Kernels(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	dims := []int{0, 1, 2, 3, 4, 5, 7, 8, 15, 16, 17, 31, 33, 100, 1000, 2048}
+	for _, dim := range dims {
+		// Offset the slices by one element to test unaligned inputs.
+		a := make([]float64, dim+1)[1:]
+		b := make([]float64, dim+1)[1:]
+		bound := 0.0
+		for i := range a {
+			a[i] = random.NormFloat64()
+			b[i] = random.NormFloat64()
+			bound += math.Abs(a[i] * b[i])
+		}
+		// The sums can only differ by rounding errors, which are bounded
+		// relative to the sum of the absolute values of the terms.
+		tolerance := 1e-13 * float64(dim) * bound
+		if got, expected := dotKernel(a, b), dotGeneric(a, b); math.Abs(got-expected) > tolerance {
+			t.Errorf("Dot of dim %d is %v, expected %v", dim, got, expected)
+		}
+		if got, expected := dotKernel(a, a), dotGeneric(a, a); math.Abs(got-expected) > 1e-13*float64(dim)*expected {
+			t.Errorf("Dot with itself of dim %d is %v, expected %v", dim, got, expected)
+		}
+		if got, expected := l2Kernel(a, b), l2Generic(a, b); math.Abs(got-expected) > 1e-13*float64(dim)*expected {
+			t.Errorf("Squared L2 of dim %d is %v, expected %v", dim, got, expected)
+		}
+		if got := l2Kernel(a, a); got != 0 {
+			t.Errorf("Squared L2 of dim %d to itself is %v, expected 0", dim, got)
+		}
+	}
+	for _, dim := range dims {
+		a := make([]float32, dim+1)[1:]
+		b := make([]float32, dim+1)[1:]
+		bound := 0.0
+		for i := range a {
+			a[i] = float32(random.NormFloat64())
+			b[i] = float32(random.NormFloat64())
+			bound += math.Abs(float64(a[i] * b[i]))
+		}
+		tolerance := 1e-6 * float64(dim) * bound
+		if got, expected := dotKernel32(a, b), dotGeneric(a, b); math.Abs(float64(got-expected)) > tolerance {
+			t.Errorf("float32 Dot of dim %d is %v, expected %v", dim, got, expected)
+		}
+		if got, expected := l2Kernel32(a, b), l2Generic(a, b); math.Abs(float64(got-expected)) > 1e-6*float64(dim)*float64(expected) {
+			t.Errorf("float32 squared L2 of dim %d is %v, expected %v", dim, got, expected)
+		}
+	}
+	// Exact on small integers.
+	p := Point{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}
+	q := Point{19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1}
+	if d := p.Dot(q); d != 1330 {
+		t.Errorf("Dot is %v, expected 1330", d)
+	}
+	if d := p.L2(q); d != math.Sqrt(2280) {
+		t.Errorf("L2 is %v, expected %v", d, math.Sqrt(2280))
+	}
+	p32, q32 := make(Point32, len(p)), make(Point32, len(q))
+	for i := range p {
+		p32[i], q32[i] = float32(p[i]), float32(q[i])
+	}
+	if d := p32.Dot(q32); d != 1330 {
+		t.Errorf("float32 Dot is %v, expected 1330", d)
+	}
+	if d := p32.L2(q32); d != math.Sqrt(2280) {
+		t.Errorf("float32 L2 is %v, expected %v", d, math.Sqrt(2280))
+	}
+	if d := p32.L1(q32); d != p.L1(q) {
+		t.Errorf("float32 L1 is %v, expected %v", d, p.L1(q))
+	}
+	// The second point may be longer, but not shorter.
+	if d := p[:3].Dot(q); d != 19+36+51 {
+		t.Errorf("Dot with a longer point is %v, expected 106", d)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Dot with a shorter point should panic")
+		}
+	}()
+	p.Dot(q[:3])
+}
+
+func Test_Dot2x4Rows(t *testing.T) {
+	testDot2x4Rows[float64](t)
+	testDot2x4Rows[float32](t)
+}
+
+func testDot2x4Rows[F Float](t *testing.T) {
+	for _, dim := range []int{0, 1, 3, 4, 7, 8, 15, 16, 17, 31, 32, 33, 63, 64, 100, 1000} {
+		x := randomPointsOf[F](2, dim, 10.0)
+		a := make([]F, 4*dim+1)[1:]
+		for i := range a {
+			a[i] = F(rand.NormFloat64())
+		}
+		s := dot2x4Rows(x[0], x[1], a)
+		for i, got := range s {
+			expected := x[i/4].Dot(a[i%4*dim : (i%4+1)*dim])
+			if got != expected {
+				t.Errorf("%T dim %d: dot product %d is %v, expected %v as Dot", F(0), dim, i, got, expected)
+			}
+		}
+	}
+}
+
+func benchmarkKernel[F Float](b *testing.B, kernel func(a, b []F) F) {
+	for _, dim := range []int{32, 128, 512, 2048} {
+		points := randomPointsOf[F](2, dim, 1.0)
+		b.Run(fmt.Sprintf("dim=%d", dim), func(b *testing.B) {
+			b.SetBytes(int64(2 * dim * int(unsafe.Sizeof(F(0)))))
+			for n := 0; n < b.N; n++ {
+				kernel(points[0], points[1])
+			}
+		})
+	}
+}
+
+func Benchmark_Dot(b *testing.B) {
+	benchmarkKernel(b, dotKernel)
+}
+
+func Benchmark_DotGeneric(b *testing.B) {
+	benchmarkKernel(b, dotGeneric[float64])
+}
+
+func Benchmark_L2(b *testing.B) {
+	benchmarkKernel(b, l2Kernel)
+}
+
+func Benchmark_L2Generic(b *testing.B) {
+	benchmarkKernel(b, l2Generic[float64])
+}
+
+func Benchmark_Dot32(b *testing.B) {
+	benchmarkKernel(b, dotKernel32)
+}
+
+func Benchmark_Dot32Generic(b *testing.B) {
+	benchmarkKernel(b, dotGeneric[float32])
+}
+
+func Benchmark_L232(b *testing.B) {
+	benchmarkKernel(b, l2Kernel32)
+}
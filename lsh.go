@@ -13,9 +13,95 @@ const (
 type hashTableKey []int
 
 // Value is an index into the input dataset.
-type hashTableBucket []string
+type hashTableBucket[K ID] []K
 
-type lshParams struct {
+// Family is a family of locality sensitive hash functions over
+// inputs of type P. An index uses one key per hash table, formed by
+// concatenating the hash values of NumHashes functions drawn from
+// the family.
+type Family[P any] interface {
+	// Dim returns the dimensionality of the input data.
+	Dim() int
+	// NumTables returns the number of hash tables.
+	NumTables() int
+	// NumHashes returns the number of hash values concatenated
+	// to form the key of each hash table.
+	NumHashes() int
+	// Hash returns the key of point for the i-th hash table.
+	Hash(point P, i int) []int
+}
+
+// HashFamily is a family of locality sensitive hash functions over
+// Points.
+type HashFamily = Family[Point]
+
+// MetricFamily is a Family that also defines the distance between
+// inputs, which indexes storing their vectors use to rank candidates.
+// All families in this package are MetricFamilies.
+type MetricFamily[P any] interface {
+	Family[P]
+	// Distance returns the distance between p and q.
+	Distance(p, q P) float64
+}
+
+// hashKeys returns all combined hash values for all hash tables.
+func hashKeys[P any](family Family[P], point P) []hashTableKey {
+	hvs := make([]hashTableKey, family.NumTables())
+	for i := range hvs {
+		hvs[i] = family.Hash(point, i)
+	}
+	return hvs
+}
+
+// queryKeys returns all combined hash values of a query point for
+// all hash tables.
+func queryKeys[P any](family Family[P], q P) []hashTableKey {
+	af, ok := family.(asymmetricFamily[P])
+	if !ok {
+		return hashKeys(family, q)
+	}
+	hvs := make([]hashTableKey, family.NumTables())
+	for i := range hvs {
+		hvs[i] = af.hashQuery(q, i)
+	}
+	return hvs
+}
+
+// asymmetricFamily is implemented by families that hash query points
+// differently from the indexed points, such as the MIPS family.
+// The hash values of indexed points may depend on all of them, so
+// indexes keep the inserted points to rehash them when necessary.
+type asymmetricFamily[P any] interface {
+	// hashQuery returns the key of query point q for the i-th table.
+	hashQuery(q P, i int) []int
+	// fit adapts the family to point before it is inserted, and
+	// returns whether the keys of the inserted points have changed.
+	fit(point P) bool
+	// clone returns a copy of the family that fit can adapt
+	// independently.
+	clone() Family[P]
+}
+
+// bitHashFamily is implemented by families whose hash values are
+// single bits (0 or 1). Multi-probe LSH probes such families by
+// flipping bits of the query key rather than stepping to adjacent slots.
+type bitHashFamily interface {
+	bitHashes()
+}
+
+// hasBitHashes returns whether the hash values of family are bits,
+// looking through the MIPS transforms to the family they wrap.
+func hasBitHashes(family any) bool {
+	if mips, ok := family.(*mipsParams); ok {
+		family = mips.family
+	}
+	_, ok := family.(bitHashFamily)
+	return ok
+}
+
+// lshParams is the family of p-stable LSH functions for L2 or L1
+// distance, h(x) = floor((a·x + b) / w), over vectors of F.
+type lshParams[F Float] struct {
 	// Dimensionality of the input data.
 	dim int
 	// Number of hash tables.
@@ -24,49 +110,112 @@ type lshParams struct {
 	m int
 	// Shared constant for each table.
 	w float64
+	// Metric selecting the p-stable distribution of a.
+	metric Metric
 
 	// Hash function params for each (l, m).
-	a [][]Point
+	a [][]Vector[F]
 	b [][]float64
+	// Contiguous l*m x dim matrix holding the vectors of a.
+	matrix []F
+}
+
+// NewL2Family creates the family of p-stable LSH functions for L2
+// distance used by default in all indexes.
+// dim is the diminsionality of the data, l is the number of hash
+// tables to use, m is the number of hash values to concatenate to
+// form the key to the hash tables, w is the slot size for the
+// family of LSH functions.
+func NewL2Family(dim, l, m int, w float64, opts ...Option) HashFamily {
+	return NewL2FamilyOf[float64](dim, l, m, w, opts...)
+}
+
+// NewL2FamilyOf creates the family of p-stable LSH functions for L2
+// distance over vectors of F, such as Point32 for float32. The
+// parameters are the same as NewL2Family, and the projections are the
+// same for the same seed, rounded to F.
+func NewL2FamilyOf[F Float](dim, l, m int, w float64, opts ...Option) Family[Vector[F]] {
+	return newLshParams[F](dim, l, m, w, L2, newConfig(opts).rand())
+}
+
+// NewL1Family creates the family of p-stable LSH functions for L1
+// distance, which draws the projections from the Cauchy distribution.
+// The parameters are the same as NewL2Family.
+func NewL1Family(dim, l, m int, w float64, opts ...Option) HashFamily {
+	return NewL1FamilyOf[float64](dim, l, m, w, opts...)
+}
+
+// NewL1FamilyOf creates the family of p-stable LSH functions for L1
+// distance over vectors of F. The parameters are the same as
+// NewL2Family.
+func NewL1FamilyOf[F Float](dim, l, m int, w float64, opts ...Option) Family[Vector[F]] {
+	return newLshParams[F](dim, l, m, w, L1, newConfig(opts).rand())
 }
 
 // NewLshParams initializes the LSH settings.
-func newLshParams(dim, l, m int, w float64) *lshParams {
+func newLshParams[F Float](dim, l, m int, w float64, metric Metric, random *rand.Rand) *lshParams[F] {
 	// Initialize hash params.
-	a := make([][]Point, l)
+	a := make([][]Vector[F], l)
 	b := make([][]float64, l)
-	random := rand.New(rand.NewSource(rand_seed))
 	for i := range a {
-		a[i] = make([]Point, m)
+		a[i] = make([]Vector[F], m)
 		b[i] = make([]float64, m)
 		for j := range a[i] {
-			a[i][j] = make(Point, dim)
+			a[i][j] = make(Vector[F], dim)
 			for d := 0; d < dim; d++ {
-				a[i][j][d] = random.NormFloat64()
+				if metric == L1 {
+					a[i][j][d] = F(cauchy(random))
+				} else {
+					a[i][j][d] = F(random.NormFloat64())
+				}
 			}
 			b[i][j] = random.Float64() * float64(w)
 		}
 	}
-	return &lshParams{
-		dim: dim,
-		l:   l,
-		m:   m,
-		a:   a,
-		b:   b,
-		w:   w,
+	return &lshParams[F]{
+		dim:    dim,
+		l:      l,
+		m:      m,
+		a:      a,
+		b:      b,
+		w:      w,
+		metric: metric,
+		matrix: packVectors(a, dim),
 	}
 }
 
-// Hash returns all combined hash values for all hash tables.
-func (lsh *lshParams) hash(point Point) []hashTableKey {
-	hvs := make([]hashTableKey, lsh.l)
-	for i := range hvs {
-		s := make(hashTableKey, lsh.m)
-		for j := 0; j < lsh.m; j++ {
-			hv := (point.Dot(lsh.a[i][j]) + lsh.b[i][j]) / lsh.w
-			s[j] = int(math.Floor(hv))
-		}
-		hvs[i] = s
+// cauchy returns a value drawn from the standard Cauchy distribution.
+func cauchy(random *rand.Rand) float64 {
+	return math.Tan(math.Pi * (random.Float64() - 0.5))
+}
+
+func (lsh *lshParams[F]) Dim() int       { return lsh.dim }
+func (lsh *lshParams[F]) NumTables() int { return lsh.l }
+func (lsh *lshParams[F]) NumHashes() int { return lsh.m }
+
+// Distance returns the L2 or L1 distance between p and q.
+func (lsh *lshParams[F]) Distance(p, q Vector[F]) float64 {
+	if lsh.metric == L1 {
+		return p.L1(q)
 	}
-	return hvs
+	return p.L2(q)
+}
+
+// Hash returns the combined hash value for the i-th hash table.
+func (lsh *lshParams[F]) Hash(point Vector[F], i int) []int {
+	s := make(hashTableKey, lsh.m)
+	for j := 0; j < lsh.m; j++ {
+		hv := (point.Dot(lsh.a[i][j]) + lsh.b[i][j]) / lsh.w
+		s[j] = int(math.Floor(hv))
+	}
+	return s
+}
+
+// HashBatch returns the combined hash values of all the points for
+// all the hash tables, computing the projections as a blocked matrix
+// multiplication.
+func (lsh *lshParams[F]) HashBatch(points []Vector[F]) [][][]int {
+	return hashBatch(lsh.matrix, lsh.dim, lsh.l, lsh.m, points, func(proj float64, i, j int) int {
+		return int(math.Floor((proj + lsh.b[i][j]) / lsh.w))
+	})
 }
@@ -1,20 +1,178 @@
 package lsh
 
 import (
+	"errors"
 	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
 )
 
 // randomPoints returns a slice of point vectors,
 // each element of every point vector is drawn from a uniform
 // distribution over [0, max)
 func randomPoints(n, dim int, max float64) []Point {
+	return randomPointsOf[float64](n, dim, max)
+}
+
+func randomPointsOf[F Float](n, dim int, max float64) []Vector[F] {
 	random := rand.New(rand.NewSource(1))
-	points := make([]Point, n)
+	points := make([]Vector[F], n)
 	for i := 0; i < n; i++ {
-		points[i] = make(Point, dim)
+		points[i] = make(Vector[F], dim)
 		for d := 0; d < dim; d++ {
-			points[i][d] = random.Float64() * max
+			points[i][d] = F(random.Float64() * max)
 		}
 	}
 	return points
 }
+
+// contains returns whether key is one of the ids.
+func contains(ids []string, key string) bool {
+	for _, id := range ids {
+		if id == key {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_L2Family(t *testing.T) {
+	family := NewL2Family(10, 3, 4, 4.0)
+	if family.Dim() != 10 || family.NumTables() != 3 || family.NumHashes() != 4 {
+		t.Error("L2 family init fail")
+	}
+	// The keys floor((a·x+b)/w) of the original implementation, with a
+	// and b drawn from rand_seed.
+	expected := [][][]int{
+		{{5, 2, 2, 0}, {-1, 2, 0, -2}, {-2, 5, -3, -4}},
+		{{-2, -1, -1, 6}, {-1, 3, -1, 2}, {6, -5, 3, 4}},
+		{{-2, 0, -1, -5}, {1, 0, 1, 0}, {-3, 4, -2, -1}},
+		{{1, 4, 5, -3}, {2, 4, -1, -4}, {0, -1, -3, -1}},
+	}
+	for i := range expected {
+		p := make(Point, 10)
+		for d := range p {
+			p[d] = float64((i*7+d*3)%11) - 5
+		}
+		keys := hashKeys(family, p)
+		for j := range keys {
+			if !reflect.DeepEqual([]int(keys[j]), expected[i][j]) {
+				t.Errorf("Key of point %d in table %d is %v, expected %v", i, j, keys[j], expected[i][j])
+			}
+		}
+	}
+}
+
+func Test_Float32Family(t *testing.T) {
+	family := NewL2FamilyOf[float32](100, 5, 5, 5.0)
+	params := NewL2Family(100, 5, 5, 5.0).(*lshParams[float64])
+	for i := range params.a {
+		for j := range params.a[i] {
+			for d, v := range params.a[i][j] {
+				if family.(*lshParams[float32]).a[i][j][d] != float32(v) {
+					t.Fatal("The float32 family should round the projections of the float64 family")
+				}
+			}
+		}
+	}
+	points := randomPointsOf[float32](100, 100, 32.0)
+	basic := NewBasicLshWithFamily(family, WithVectors())
+	forest := NewLshForestWithFamily(NewL2FamilyOf[float32](100, 5, 5, 5.0))
+	multiprobe := NewMultiprobeLshWithFamily(NewL1FamilyOf[float32](100, 5, 5, 50.0), 10)
+	for i, p := range points {
+		basic.Insert(p, strconv.Itoa(i))
+		forest.Insert(p, strconv.Itoa(i))
+		multiprobe.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		key := strconv.Itoa(i)
+		if !contains(basic.Query(p), key) || !contains(forest.Query(p, 5), key) || !contains(multiprobe.Query(p), key) {
+			t.Errorf("Query of point %d fails to return itself", i)
+		}
+		if neighbors := basic.QueryKNN(p, 1); neighbors[0].ID != key || neighbors[0].Distance != 0 {
+			t.Errorf("QueryKNN of point %d returns %v", i, neighbors)
+		}
+	}
+	if _, err := basic.TryQuery(Point32{1}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func Test_L1(t *testing.T) {
+	if d := (Point{1, 2, 3}).L1(Point{2, 0, 3}); d != 3 {
+		t.Errorf("Expected L1 distance 3, got %v", d)
+	}
+}
+
+func Test_L1Family(t *testing.T) {
+	family := NewL1Family(100, 5, 5, 50.0)
+	if family.(*lshParams[float64]).metric != L1 {
+		t.Error("L1 family init fail")
+	}
+	points := randomPoints(10, 100, 32.0)
+	basic := NewBasicLsh(100, 5, 5, 50.0, WithMetric(L1))
+	forest := NewLshForest(100, 5, 5, 50.0, WithMetric(L1))
+	multiprobe := NewMultiprobeLsh(100, 5, 5, 50.0, 10, WithMetric(L1))
+	for i, p := range points {
+		if !reflect.DeepEqual(hashKeys(basic.family, p), hashKeys(family, p)) {
+			t.Error("NewBasicLsh should use the L1 family")
+		}
+		basic.Insert(p, strconv.Itoa(i))
+		forest.Insert(p, strconv.Itoa(i))
+		multiprobe.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		key := strconv.Itoa(i)
+		if !contains(basic.Query(p), key) {
+			t.Error("BasicLsh query fail")
+		}
+		if !contains(forest.Query(p, 5), key) {
+			t.Error("LshForest query fail")
+		}
+		if !contains(multiprobe.Query(p), key) {
+			t.Error("MultiprobeLsh query fail")
+		}
+	}
+}
+
+// checkNeighbors verifies that the neighbors are sorted by their
+// exact L2 distances to q, and that the nearest one is id.
+func checkNeighbors(t *testing.T, neighbors []Neighbor, q Point, points []Point, id string, k int) {
+	if len(neighbors) == 0 || len(neighbors) > k {
+		t.Fatalf("Expected 1 to %d neighbors, found %d", k, len(neighbors))
+	}
+	if neighbors[0].ID != id || neighbors[0].Distance != 0 {
+		t.Errorf("Nearest neighbor should be %s itself, found %v", id, neighbors[0])
+	}
+	for i, n := range neighbors {
+		j, _ := strconv.Atoi(n.ID)
+		if n.Distance != points[j].L2(q) {
+			t.Errorf("Wrong distance %v for %s", n.Distance, n.ID)
+		}
+		if i > 0 && n.Distance < neighbors[i-1].Distance {
+			t.Errorf("Neighbors not sorted: %v", neighbors)
+		}
+	}
+}
+
+// checkRadius verifies that the neighbors are sorted by their exact
+// L2 distances to q, all within r, and include id.
+func checkRadius(t *testing.T, neighbors []Neighbor, q Point, points []Point, id string, r float64) {
+	found := false
+	for i, n := range neighbors {
+		j, _ := strconv.Atoi(n.ID)
+		if n.Distance != points[j].L2(q) || n.Distance > r {
+			t.Errorf("Wrong distance %v for %s", n.Distance, n.ID)
+		}
+		if i > 0 && n.Distance < neighbors[i-1].Distance {
+			t.Errorf("Neighbors not sorted: %v", neighbors)
+		}
+		if n.ID == id {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Query point %s not found within radius %v", id, r)
+	}
+}
@@ -2,24 +2,61 @@ package lsh
 
 import "math"
 
-// Point is a vector in the L2 metric space.
-type Point []float64
+// Metric is a distance metric supported by the p-stable LSH family.
+type Metric int
+
+const (
+	// L2 is the Euclidean distance, hashed using projections drawn
+	// from the Gaussian (2-stable) distribution.
+	L2 Metric = iota
+	// L1 is the Manhattan distance, hashed using projections drawn
+	// from the Cauchy (1-stable) distribution.
+	L1
+)
+
+// Float is the type of the elements of a Vector.
+type Float interface {
+	float32 | float64
+}
+
+// Vector is a vector of float32 or float64 elements in the L2 metric
+// space. Distances and dot products are returned as float64 for both
+// element types.
+type Vector[F Float] []F
+
+// Point is a vector of float64 elements in the L2 metric space.
+type Point = Vector[float64]
+
+// Point32 is a vector of float32 elements, which takes half the
+// memory of a Point.
+type Point32 = Vector[float32]
 
 // Dot returns the dot product of two points.
-func (p Point) Dot(q Point) float64 {
+func (p Vector[F]) Dot(q Vector[F]) float64 {
+	return dot(p, truncate(q, len(p)))
+}
+
+// L2 returns the L2 distance of two points.
+func (p Vector[F]) L2(q Vector[F]) float64 {
+	return math.Sqrt(l2Squared(p, truncate(q, len(p))))
+}
+
+// L1 returns the L1 distance of two points.
+func (p Vector[F]) L1(q Vector[F]) float64 {
 	s := 0.0
 	for i := 0; i < len(p); i++ {
-		s += p[i] * q[i]
+		s += math.Abs(float64(p[i]) - float64(q[i]))
 	}
 	return s
 }
 
-// L2 returns the L2 distance of two points.
-func (p Point) L2(q Point) float64 {
-	s := 0.0
-	for i := 0; i < len(p); i++ {
-		d := p[i] - q[i]
-		s += d * d
+// Cosine returns the cosine distance of two points, that is,
+// 1 minus the cosine of the angle between them.
+// The distance to a zero vector is 1.
+func (p Vector[F]) Cosine(q Vector[F]) float64 {
+	pp, qq := p.Dot(p), q.Dot(q)
+	if pp == 0 || qq == 0 {
+		return 1
 	}
-	return math.Sqrt(s)
+	return 1 - p.Dot(q)/math.Sqrt(pp*qq)
 }
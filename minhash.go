@@ -0,0 +1,180 @@
+package lsh
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Signature is a MinHash signature of a set.
+type Signature []uint64
+
+// Jaccard returns the estimated Jaccard similarity of the two sets
+// from which the signatures were generated, that is, the fraction
+// of their hash values that are equal.
+// Both signatures must be generated by the same Minhash.
+func (sig Signature) Jaccard(other Signature) float64 {
+	if len(sig) != len(other) {
+		panic("Signatures have different numbers of hash values")
+	}
+	if len(sig) == 0 {
+		return 0
+	}
+	equal := 0
+	for i := range sig {
+		if sig[i] == other[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(sig))
+}
+
+// Minhash generates MinHash signatures of sets of uint64 elements
+// by Andrei Broder, for estimating Jaccard similarity.
+type Minhash struct {
+	// Seed of each hash function.
+	seeds []uint64
+}
+
+// NewMinhash creates a MinHash signature generator using numHash
+// hash functions.
+func NewMinhash(numHash int, opts ...Option) *Minhash {
+	random := newConfig(opts).rand()
+	seeds := make([]uint64, numHash)
+	for i := range seeds {
+		seeds[i] = random.Uint64()
+	}
+	return &Minhash{
+		seeds: seeds,
+	}
+}
+
+// permute is a random permutation of the uint64 values selected by
+// seed, which is the finalizer of SplitMix64 applied to x xor seed.
+func permute(x, seed uint64) uint64 {
+	z := x ^ seed
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// minValues returns the minimum hash values of set under the hash
+// functions from index lo to hi (exclusive).
+func (mh *Minhash) minValues(set []uint64, lo, hi int) []uint64 {
+	mins := make([]uint64, hi-lo)
+	for i := range mins {
+		mins[i] = math.MaxUint64
+	}
+	for _, x := range set {
+		for i, seed := range mh.seeds[lo:hi] {
+			if hv := permute(x, seed); hv < mins[i] {
+				mins[i] = hv
+			}
+		}
+	}
+	return mins
+}
+
+// Signature returns the MinHash signature of set.
+func (mh *Minhash) Signature(set []uint64) Signature {
+	return Signature(mh.minValues(set, 0, len(mh.seeds)))
+}
+
+// HashStrings converts a set of strings to a set of uint64 elements
+// using the 64-bit FNV-1a hash, for use with Minhash and the
+// MinHash indexes.
+func HashStrings(set []string) []uint64 {
+	hashed := make([]uint64, len(set))
+	for i, s := range set {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		hashed[i] = h.Sum64()
+	}
+	return hashed
+}
+
+// minhashParams is the family of MinHash functions for Jaccard
+// similarity of sets. A signature of b*r hash values is split into
+// b bands of r rows, one band per hash table.
+type minhashParams struct {
+	// Number of bands, which is the number of hash tables.
+	b int
+	// Number of rows in each band.
+	r int
+
+	minhash *Minhash
+}
+
+// NewMinhashFamily creates the family of MinHash functions for
+// Jaccard similarity of sets of uint64 elements.
+// b is the number of bands (hash tables) and r is the number of
+// rows (hash values) in each band. Two sets with Jaccard similarity
+// s share a band with probability 1 - (1 - s^r)^b.
+// The rows of the bands are the hash values of the signature
+// generated by NewMinhash(b*r) with the same options.
+func NewMinhashFamily(b, r int, opts ...Option) Family[[]uint64] {
+	return &minhashParams{
+		b:       b,
+		r:       r,
+		minhash: NewMinhash(b*r, opts...),
+	}
+}
+
+// Dim returns 0, as sets have no fixed dimensionality.
+func (mh *minhashParams) Dim() int       { return 0 }
+func (mh *minhashParams) NumTables() int { return mh.b }
+func (mh *minhashParams) NumHashes() int { return mh.r }
+
+// Distance returns the Jaccard distance between the sets p and q,
+// 1 minus their exact Jaccard similarity.
+func (mh *minhashParams) Distance(p, q []uint64) float64 {
+	return 1 - jaccard(p, q)
+}
+
+// jaccard returns the Jaccard similarity of two sets.
+func jaccard(p, q []uint64) float64 {
+	elements := make(map[uint64]bool, len(p))
+	for _, x := range p {
+		elements[x] = true
+	}
+	intersection, union := 0, len(elements)
+	seen := make(map[uint64]bool, len(q))
+	for _, x := range q {
+		if seen[x] {
+			continue
+		}
+		seen[x] = true
+		if elements[x] {
+			intersection++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 1
+	}
+	return float64(intersection) / float64(union)
+}
+
+// Hash returns the rows of the i-th band of the signature of set.
+func (mh *minhashParams) Hash(set []uint64, i int) []int {
+	mins := mh.minhash.minValues(set, i*mh.r, (i+1)*mh.r)
+	s := make(hashTableKey, mh.r)
+	for j, hv := range mins {
+		s[j] = int(hv)
+	}
+	return s
+}
+
+// NewMinhashLsh creates a banded MinHash LSH for Jaccard similarity
+// of sets of uint64 elements, using b hash tables keyed by bands of
+// r rows. Use HashStrings to index sets of strings.
+func NewMinhashLsh(b, r int, opts ...Option) *BasicIndex[[]uint64] {
+	return NewBasicLshWithFamily(NewMinhashFamily(b, r, opts...), opts...)
+}
+
+// NewMinhashLshForest creates a MinHash LSH Forest for Jaccard
+// similarity of sets of uint64 elements, using b prefix trees of
+// depth r. Use HashStrings to index sets of strings.
+func NewMinhashLshForest(b, r int, opts ...Option) *ForestIndex[[]uint64] {
+	return NewLshForestWithFamily(NewMinhashFamily(b, r, opts...), opts...)
+}
@@ -0,0 +1,67 @@
+package lsh
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// rangeSet returns the set of integers in [lo, hi).
+func rangeSet(lo, hi int) []uint64 {
+	set := make([]uint64, 0, hi-lo)
+	for x := lo; x < hi; x++ {
+		set = append(set, uint64(x))
+	}
+	return set
+}
+
+func Test_MinhashJaccard(t *testing.T) {
+	mh := NewMinhash(256)
+	a := mh.Signature(rangeSet(0, 1000))
+	b := mh.Signature(rangeSet(500, 1500))
+	if len(a) != 256 {
+		t.Errorf("Expected 256 hash values, found %d", len(a))
+	}
+	if est := a.Jaccard(a); est != 1 {
+		t.Errorf("Jaccard of identical sets should be 1, got %v", est)
+	}
+	if est := a.Jaccard(b); math.Abs(est-1.0/3) > 0.1 {
+		t.Errorf("Jaccard estimate %v too far from 1/3", est)
+	}
+	if est := a.Jaccard(mh.Signature(rangeSet(2000, 3000))); est > 0.05 {
+		t.Errorf("Jaccard estimate %v of disjoint sets too high", est)
+	}
+}
+
+func Test_MinhashLsh(t *testing.T) {
+	lsh := NewMinhashLsh(16, 4)
+	forest := NewMinhashLshForest(16, 4)
+	sets := make([][]uint64, 10)
+	for i := range sets {
+		sets[i] = rangeSet(i*1000, i*1000+100)
+		lsh.Insert(sets[i], strconv.Itoa(i))
+		forest.Insert(sets[i], strconv.Itoa(i))
+	}
+	for i := range sets {
+		// A near duplicate with 90 of the 100 elements.
+		q := sets[i][:90]
+		ids := lsh.Query(q)
+		if len(ids) != 1 || ids[0] != strconv.Itoa(i) {
+			t.Errorf("Query fail: expected [%d], got %v", i, ids)
+		}
+		ids = forest.Query(q, 1)
+		if len(ids) != 1 || ids[0] != strconv.Itoa(i) {
+			t.Errorf("LshForest query fail: expected [%d], got %v", i, ids)
+		}
+	}
+}
+
+func Test_MinhashLshStrings(t *testing.T) {
+	lsh := NewMinhashLsh(16, 4)
+	lsh.Insert(HashStrings([]string{"the", "quick", "brown", "fox", "jumps", "over", "the", "lazy", "dog"}), "fox")
+	lsh.Insert(HashStrings([]string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit"}), "lorem")
+	ids := lsh.Query(HashStrings([]string{"the", "quick", "brown", "fox", "jumps", "over", "a", "lazy", "dog"}))
+	if len(ids) != 1 || ids[0] != "fox" {
+		t.Errorf("Query fail: expected [fox], got %v", ids)
+	}
+}
@@ -0,0 +1,99 @@
+package lsh
+
+import (
+	"math"
+)
+
+// mipsParams is the family for maximum inner product search (MIPS)
+// using the Simple-LSH asymmetric transforms by Behnam Neyshabur and
+// Nathan Srebro. Indexed points x are scaled by the max norm M and
+// augmented to unit norm, P(x) = [x/M, sqrt(1 - |x/M|^2)], and queries
+// are normalized and augmented with zero, Q(q) = [q/|q|, 0], so that
+// both the L2 and cosine distances between Q(q) and P(x) decrease
+// as the inner product q·x increases.
+type mipsParams struct {
+	// Family over the augmented points.
+	family HashFamily
+	// Max norm of the inserted points.
+	maxNorm float64
+}
+
+// NewMipsFamily creates a family for maximum inner product search
+// of dim dimensional points, where family is a family for L2 or
+// cosine distance of dim+1 dimensional points, for example
+// NewCosineFamily(dim+1, l, m). Since the augmented points have
+// unit norm, a slot size w around 1 suits the L2 family.
+// maxNorm is the expected max norm of the data. Each index keeps its
+// own copy of the family, and rehashes all inserted points whenever an
+// insert exceeds its max norm, which then grows to at least 1.5 times
+// the previous one, so a good estimate avoids rebuilds.
+func NewMipsFamily(family HashFamily, maxNorm float64) HashFamily {
+	return &mipsParams{
+		family:  family,
+		maxNorm: maxNorm,
+	}
+}
+
+func (mips *mipsParams) Dim() int       { return mips.family.Dim() - 1 }
+func (mips *mipsParams) NumTables() int { return mips.family.NumTables() }
+func (mips *mipsParams) NumHashes() int { return mips.family.NumHashes() }
+
+// Distance returns the negative inner product of p and q, so that
+// the nearest neighbours have the largest inner products.
+func (mips *mipsParams) Distance(p, q Point) float64 { return -p.Dot(q) }
+
+// Hash returns the key of the transformed data point for the i-th
+// hash table.
+func (mips *mipsParams) Hash(point Point, i int) []int {
+	return mips.family.Hash(mips.transformData(point), i)
+}
+
+// hashQuery returns the key of the transformed query point for the
+// i-th hash table.
+func (mips *mipsParams) hashQuery(q Point, i int) []int {
+	return mips.family.Hash(mips.transformQuery(q), i)
+}
+
+// fit raises the max norm to the norm of point if it exceeds it, and
+// at least by half so that growing norms rehash only a few times.
+func (mips *mipsParams) fit(point Point) bool {
+	norm := math.Sqrt(point.Dot(point))
+	if norm <= mips.maxNorm {
+		return false
+	}
+	mips.maxNorm = math.Max(norm, 1.5*mips.maxNorm)
+	return true
+}
+
+func (mips *mipsParams) clone() HashFamily {
+	clone := *mips
+	return &clone
+}
+
+func (mips *mipsParams) transformData(point Point) Point {
+	p := make(Point, len(point)+1)
+	if mips.maxNorm == 0 {
+		p[len(point)] = 1
+		return p
+	}
+	s := 0.0
+	for d, v := range point {
+		p[d] = v / mips.maxNorm
+		s += p[d] * p[d]
+	}
+	// Points exceeding the max norm are not augmented.
+	p[len(point)] = math.Sqrt(math.Max(0, 1-s))
+	return p
+}
+
+func (mips *mipsParams) transformQuery(q Point) Point {
+	p := make(Point, len(q)+1)
+	norm := math.Sqrt(q.Dot(q))
+	if norm == 0 {
+		return p
+	}
+	for d, v := range q {
+		p[d] = v / norm
+	}
+	return p
+}
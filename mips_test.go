@@ -0,0 +1,129 @@
+package lsh
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func Test_MipsTransform(t *testing.T) {
+	mips := NewMipsFamily(NewCosineFamily(3, 1, 1), 5).(*mipsParams)
+	p := mips.transformData(Point{3, 0})
+	if math.Abs(p.Dot(p)-1) > 1e-12 || p[0] != 0.6 {
+		t.Errorf("Transformed data point should have unit norm: %v", p)
+	}
+	q := mips.transformQuery(Point{0, 2})
+	if !reflect.DeepEqual(q, Point{0, 1, 0}) {
+		t.Errorf("Transformed query point should be normalized: %v", q)
+	}
+	if mips.fit(Point{3, 4}) || !mips.fit(Point{6, 8}) || mips.maxNorm != 10 {
+		t.Error("Max norm should only grow for points exceeding it")
+	}
+	if !mips.fit(Point{11}) || mips.maxNorm != 15 {
+		t.Errorf("Max norm should grow by at least half, got %v", mips.maxNorm)
+	}
+}
+
+func Test_MipsSharedFamily(t *testing.T) {
+	family := NewMipsFamily(NewCosineFamily(3, 2, 4), 1)
+	a := NewBasicLshWithFamily(family)
+	b := NewLshForestWithFamily(family)
+	a.Insert(Point{10, 0}, "a")
+	if family.(*mipsParams).maxNorm != 1 || b.family.(*mipsParams).maxNorm != 1 {
+		t.Error("Inserting into an index should not change the max norm of other indexes")
+	}
+	b.Insert(Point{1, 0}, "b")
+	if !reflect.DeepEqual(a.Query(Point{1, 0}), []string{"a"}) {
+		t.Error("Keys of an index should not change when inserting into another")
+	}
+}
+
+func Test_MipsQuery(t *testing.T) {
+	points := randomPoints(100, 20, 1.0)
+	for i, p := range points {
+		// Vary the norms of the points.
+		for d := range p {
+			p[d] = (p[d] - 0.5) * float64(1+i%7)
+		}
+	}
+	lsh := NewMultiprobeLshWithFamily(NewMipsFamily(NewCosineFamily(21, 10, 6), 0), 16)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	queries := randomPoints(10, 20, 1.0)
+	found := 0
+	for _, q := range queries {
+		for d := range q {
+			q[d] -= 0.5
+		}
+		best, bestDot := 0, math.Inf(-1)
+		for i, p := range points {
+			if dot := q.Dot(p); dot > bestDot {
+				best, bestDot = i, dot
+			}
+		}
+		if contains(lsh.Query(q), strconv.Itoa(best)) {
+			found++
+		}
+	}
+	if found < 8 {
+		t.Errorf("Max inner product point found for only %d of 10 queries", found)
+	}
+}
+
+func Test_MipsCosinePerturbKeys(t *testing.T) {
+	lsh := NewMultiprobeLshWithFamily(NewMipsFamily(NewCosineFamily(11, 4, 6), 0), 20)
+	baseKey := queryKeys(lsh.family, randomPoints(1, 10, 1.0)[0])
+	for _, perturbation := range lsh.perturbVecs {
+		for _, key := range lsh.perturb(baseKey, perturbation) {
+			for _, hv := range key {
+				if hv != 0 && hv != 1 {
+					t.Fatalf("Perturbed key %v of MIPS over cosine should only have bits", key)
+				}
+			}
+		}
+	}
+}
+
+func Test_MipsRehash(t *testing.T) {
+	points := randomPoints(20, 10, 1.0)
+	for i, p := range points {
+		for d := range p {
+			p[d] *= float64(1 + i)
+		}
+	}
+	// Inserting with increasing norms rehashes as the max norm grows.
+	basic := NewBasicLshWithFamily(NewMipsFamily(NewCosineFamily(11, 5, 4), 0))
+	forest := NewLshForestWithFamily(NewMipsFamily(NewCosineFamily(11, 5, 4), 0))
+	for i, p := range points {
+		basic.Insert(p, strconv.Itoa(i))
+		forest.Insert(p, strconv.Itoa(i))
+	}
+	// Knowing the final max norm never rehashes.
+	maxNorm := basic.family.(*mipsParams).maxNorm
+	if forestNorm := forest.family.(*mipsParams).maxNorm; forestNorm != maxNorm {
+		t.Fatalf("Max norms of the basic LSH and forest differ: %v and %v", maxNorm, forestNorm)
+	}
+	expectedBasic := NewBasicLshWithFamily(NewMipsFamily(NewCosineFamily(11, 5, 4), maxNorm))
+	expectedForest := NewLshForestWithFamily(NewMipsFamily(NewCosineFamily(11, 5, 4), maxNorm))
+	for i, p := range points {
+		expectedBasic.Insert(p, strconv.Itoa(i))
+		expectedForest.Insert(p, strconv.Itoa(i))
+	}
+	for i := range basic.tables {
+		if len(basic.tables[i]) != len(expectedBasic.tables[i]) {
+			t.Errorf("Table %d has %d buckets, expected %d", i, len(basic.tables[i]), len(expectedBasic.tables[i]))
+		}
+		for _, entry := range expectedBasic.tables[i] {
+			if rehashed := basic.tables[i].get(entry.key); rehashed == nil || len(rehashed.ids) != len(entry.ids) {
+				t.Errorf("Bucket %v of table %d not rehashed", entry.key, i)
+			}
+		}
+	}
+	for i := range forest.trees {
+		if forest.trees[i].count != expectedForest.trees[i].count {
+			t.Errorf("Tree %d has %d hash values, expected %d", i, forest.trees[i].count, expectedForest.trees[i].count)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package lsh
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the first size bytes of f into memory, on platforms
+// without memory-mapped files.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// munmapFile releases data read by mmapFile.
+func munmapFile(data []byte) error {
+	return nil
+}
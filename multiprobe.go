@@ -2,6 +2,10 @@ package lsh
 
 import (
 	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
 	"math/rand"
 )
 
@@ -21,6 +25,16 @@ func (ps perturbSet) isValid(m int) bool {
 	return true
 }
 
+func (ps perturbSet) max() int {
+	max := 0
+	for k := range ps {
+		if k > max {
+			max = k
+		}
+	}
+	return max
+}
+
 func (ps perturbSet) shift() perturbSet {
 	next := make(perturbSet)
 	max := 0
@@ -75,10 +89,11 @@ func (h *perturbSetHeap) Pop() interface{} {
 	return x
 }
 
-// MultiprobeLsh implements the Multi-probe LSH algorithm by Qin Lv et.al.
-// The Multi-probe LSH does not support k-NN query directly.
-type MultiprobeLsh struct {
-	*BasicLsh
+// MultiprobeIndexOf implements the Multi-probe LSH algorithm by Qin Lv
+// et.al. for inputs of type P identified by ids of type K, using a
+// family of hash functions over P.
+type MultiprobeIndexOf[P any, K ID] struct {
+	*BasicIndexOf[P, K]
 	// The size of our probe sequence.
 	t int
 
@@ -94,6 +109,13 @@ type MultiprobeLsh struct {
 	perturbVecs [][][]int
 }
 
+// MultiprobeIndex implements the Multi-probe LSH algorithm for inputs
+// of type P identified by string ids.
+type MultiprobeIndex[P any] = MultiprobeIndexOf[P, string]
+
+// MultiprobeLsh implements the Multi-probe LSH algorithm for L2 distance.
+type MultiprobeLsh = MultiprobeIndex[Point]
+
 // NewMultiprobeLsh creates a new Multi-probe LSH for L2 distance.
 // dim is the diminsionality of the data, l is the number of hash
 // tables to use, m is the number of hash values to concatenate to
@@ -102,17 +124,71 @@ type MultiprobeLsh struct {
 // t is the number of perturbation vectors that will be applied to
 // each query.
 // Increasing t increases the running time of the Query function.
-func NewMultiprobeLsh(dim, l, m int, w float64, t int) *MultiprobeLsh {
-	index := &MultiprobeLsh{
-		BasicLsh: NewBasicLsh(dim, l, m, w),
-		t:        t,
+// It panics if t exceeds the 3^m-1 valid perturbation sets, see
+// NewMultiprobeLshFromParams for a variant returning errors.
+// By default the LSH is for L2 distance, use WithMetric(L1) for L1.
+func NewMultiprobeLsh(dim, l, m int, w float64, t int, opts ...Option) *MultiprobeLsh {
+	cfg := newConfig(opts)
+	return NewMultiprobeLshWithFamily(newLshParams[float64](dim, l, m, w, cfg.metric, cfg.rand()), t, opts...)
+}
+
+// NewMultiprobeLshFromParams creates a new Multi-probe LSH like
+// NewMultiprobeLsh, but validates the parameters and options first and
+// returns an error wrapping ErrInvalidParams if any is invalid,
+// including a t larger than the 3^m-1 valid perturbation sets.
+func NewMultiprobeLshFromParams(params Params, opts ...Option) (*MultiprobeLsh, error) {
+	family, err := newLshParamsFromParams(params, opts)
+	if err != nil {
+		return nil, err
+	}
+	index := &MultiprobeIndex[Point]{
+		BasicIndexOf: NewBasicLshWithFamily[Point](family, opts...),
+		t:            params.T,
+	}
+	if err := index.initProbeSequence(newConfig(opts)); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// NewMultiprobeLshWithFamily creates a new Multi-probe LSH using the
+// given family of hash functions. The perturbation vectors step each
+// hash value to its adjacent slots, so the family should produce
+// quantized projections like the default L2 family does. For families
+// of bit hashes such as NewCosineFamily and NewHammingFamily, and
+// NewMipsFamily over them, the query key is probed by flipping its
+// bits in increasing Hamming radius instead, and t is capped at the
+// 2^m-1 sets of bits to flip. For other families it panics if t
+// exceeds the 3^m-1 valid perturbation sets.
+func NewMultiprobeLshWithFamily[P any](family Family[P], t int, opts ...Option) *MultiprobeIndex[P] {
+	return NewMultiprobeIndexOf[string](family, t, opts...)
+}
+
+// NewMultiprobeIndexOf creates a new Multi-probe LSH like
+// NewMultiprobeLshWithFamily, for points identified by ids of type K.
+func NewMultiprobeIndexOf[K ID, P any](family Family[P], t int, opts ...Option) *MultiprobeIndexOf[P, K] {
+	index := &MultiprobeIndexOf[P, K]{
+		BasicIndexOf: NewBasicIndexOf[K](family, opts...),
+		t:            t,
+	}
+	if err := index.initProbeSequence(newConfig(opts)); err != nil {
+		panic(err)
 	}
-	index.initProbeSequence()
 	return index
 }
 
-func (index *MultiprobeLsh) initProbeSequence() {
-	m := index.m
+func (index *MultiprobeIndexOf[P, K]) initProbeSequence(cfg *config) error {
+	if err := index.initPerturbSets(); err != nil {
+		return err
+	}
+	index.genPerturbVecs(cfg)
+	return nil
+}
+
+// initPerturbSets computes the scores of the perturbation values and
+// generates the perturbation sets of the probe sequence.
+func (index *MultiprobeIndexOf[P, K]) initPerturbSets() error {
+	m := index.family.NumHashes()
 	index.scores = make([]float64, 2*m)
 	// Use j's starting from 1 to match the paper.
 	for j := 1; j <= m; j++ {
@@ -121,11 +197,37 @@ func (index *MultiprobeLsh) initProbeSequence() {
 	for j := m + 1; j <= 2*m; j++ {
 		index.scores[j-1] = 1 - float64(2*m+1-j)/float64(m+1) + float64((2*m+1-j)*(2*m+2-j))/float64(4*(m+1)*(m+2))
 	}
-	index.genPerturbSets()
-	index.genPerturbVecs()
+	if index.t < 0 {
+		return fmt.Errorf("%w: t must not be negative, got %d", ErrInvalidParams, index.t)
+	}
+	if hasBitHashes(index.family) {
+		index.genFlipSets()
+		return nil
+	}
+	// Check t before searching the perturbation sets, which takes time
+	// growing with t.
+	if n := numPerturbSets(m); index.t > n {
+		return fmt.Errorf("%w: t = %d exceeds the %d valid perturbation sets for m = %d",
+			ErrInvalidParams, index.t, n, m)
+	}
+	return index.genPerturbSets()
+}
+
+// maxProbes returns the number of perturbation sets of the family:
+// the 2^m-1 sets of bits to flip for bit hash families, and the 3^m-1
+// valid perturbation sets otherwise.
+func (index *MultiprobeIndexOf[P, K]) maxProbes() int {
+	m := index.family.NumHashes()
+	if hasBitHashes(index.family) {
+		if m >= bits.UintSize-1 {
+			return math.MaxInt
+		}
+		return 1<<m - 1
+	}
+	return numPerturbSets(m)
 }
 
-func (index *MultiprobeLsh) getScore(ps *perturbSet) float64 {
+func (index *MultiprobeIndexOf[P, K]) getScore(ps *perturbSet) float64 {
 	score := 0.0
 	for j := range *ps {
 		score += index.scores[j-1]
@@ -133,7 +235,10 @@ func (index *MultiprobeLsh) getScore(ps *perturbSet) float64 {
 	return score
 }
 
-func (index *MultiprobeLsh) genPerturbSets() {
+// genPerturbSets generates the t valid perturbation sets with the
+// lowest scores. There are 3^m-1 valid perturbation sets, an error is
+// returned if t exceeds that.
+func (index *MultiprobeIndexOf[P, K]) genPerturbSets() error {
 	setHeap := make(perturbSetHeap, 1)
 	start := perturbSet{1: true}
 	setHeap[0] = perturbSetPair{
@@ -142,60 +247,109 @@ func (index *MultiprobeLsh) genPerturbSets() {
 	}
 	heap.Init(&setHeap)
 	index.perturbSets = make([]perturbSet, index.t)
-	m := index.m
+	m := index.family.NumHashes()
 
 	for i := 0; i < index.t; i++ {
-		for counter := 0; true; counter++ {
+		for {
+			if setHeap.Len() == 0 {
+				return fmt.Errorf("%w: t = %d exceeds the %d valid perturbation sets for m = %d",
+					ErrInvalidParams, index.t, i, m)
+			}
 			currentTop := heap.Pop(&setHeap).(perturbSetPair)
-			nextShift := currentTop.ps.shift()
-			heap.Push(&setHeap, perturbSetPair{
-				ps:    nextShift,
-				score: index.getScore(&nextShift),
-			})
-			nextExpand := currentTop.ps.expand()
-			heap.Push(&setHeap, perturbSetPair{
-				ps:    nextExpand,
-				score: index.getScore(&nextExpand),
-			})
+			// Sets with keys larger than 2m and all the sets generated
+			// from them are invalid.
+			if currentTop.ps.max() < 2*m {
+				nextShift := currentTop.ps.shift()
+				heap.Push(&setHeap, perturbSetPair{
+					ps:    nextShift,
+					score: index.getScore(&nextShift),
+				})
+				nextExpand := currentTop.ps.expand()
+				heap.Push(&setHeap, perturbSetPair{
+					ps:    nextExpand,
+					score: index.getScore(&nextExpand),
+				})
+			}
 
 			if currentTop.ps.isValid(m) {
 				index.perturbSets[i] = currentTop.ps
 				break
 			}
-			if counter >= 2*m {
-				panic("too many iterations, probably infinite loop!")
+		}
+	}
+	return nil
+}
+
+// genFlipSets generates the perturbation sets for families of bit
+// hashes: the sets of bits to flip, ordered by Hamming radius.
+// Unit perturbation j flips the bit mapped from j, so only 1..m are used.
+// There are 2^m-1 flip sets, t is lowered to that if it exceeds it.
+func (index *MultiprobeIndexOf[P, K]) genFlipSets() {
+	m := index.family.NumHashes()
+	index.perturbSets = make([]perturbSet, 0, index.t)
+	for radius := 1; radius <= m && len(index.perturbSets) < index.t; radius++ {
+		// Enumerate combinations of radius bits in lexicographic order.
+		combination := make([]int, radius)
+		for i := range combination {
+			combination[i] = i + 1
+		}
+		for len(index.perturbSets) < index.t {
+			ps := make(perturbSet)
+			for _, k := range combination {
+				ps[k] = true
+			}
+			index.perturbSets = append(index.perturbSets, ps)
+			i := radius - 1
+			for i >= 0 && combination[i] == m-radius+i+1 {
+				i--
+			}
+			if i < 0 {
+				break
+			}
+			combination[i]++
+			for j := i + 1; j < radius; j++ {
+				combination[j] = combination[j-1] + 1
 			}
 		}
 	}
+	index.t = len(index.perturbSets)
 }
 
-func (index *MultiprobeLsh) genPerturbVecs() {
+func (index *MultiprobeIndexOf[P, K]) genPerturbVecs(cfg *config) {
 	// First we need to generate the permutation tables
 	// that maps the ids of the unit perturbation in each
 	// perturbation set to the index of the unit hash
 	// value
-	perms := make([][]int, index.l)
+	m := index.family.NumHashes()
+	perms := make([][]int, len(index.tables))
+	var random *rand.Rand
+	if cfg.source != nil {
+		random = cfg.rand()
+	}
 	for i := range index.tables {
-		random := rand.New(rand.NewSource(int64(i)))
-		perm := random.Perm(index.m)
-		perms[i] = make([]int, index.m*2)
-		for j := 0; j < index.m; j++ {
+		if cfg.source == nil {
+			// By default the permutation is seeded with the table index.
+			random = rand.New(rand.NewSource(int64(i)))
+		}
+		perm := random.Perm(m)
+		perms[i] = make([]int, m*2)
+		for j := 0; j < m; j++ {
 			perms[i][j] = perm[j]
 		}
-		for j := 0; j < index.m; j++ {
-			perms[i][j+index.m] = perm[index.m-1-j]
+		for j := 0; j < m; j++ {
+			perms[i][j+m] = perm[m-1-j]
 		}
 	}
 
 	// Generate the vectors
 	index.perturbVecs = make([][][]int, len(index.perturbSets))
 	for i, ps := range index.perturbSets {
-		perTableVecs := make([][]int, index.l)
+		perTableVecs := make([][]int, len(index.tables))
 		for j := range perTableVecs {
-			vec := make([]int, index.m)
+			vec := make([]int, m)
 			for k := range ps {
 				mapped_ind := perms[j][k-1]
-				if k > index.m {
+				if k > m {
 					// If it is -1
 					vec[mapped_ind] = -1
 				} else {
@@ -209,42 +363,92 @@ func (index *MultiprobeLsh) genPerturbVecs() {
 	}
 }
 
-func (index *MultiprobeLsh) queryHelper(tableKeys []hashTableKey, out chan<- string) {
+func (index *MultiprobeIndexOf[P, K]) queryHelper(tableKeys []hashTableKey, out chan<- K) {
 	// Apply hash functions
-	hvs := index.toBasicHashTableKeys(tableKeys)
-
 	// Lookup in each table.
 	for i, table := range index.tables {
-		if candidates, exist := table[hvs[i]]; exist {
-			for _, id := range candidates {
+		index.tableLocks[i].RLock()
+		if entry := table.get(tableKeys[i]); entry != nil {
+			for _, id := range entry.ids {
 				out <- id
 			}
 		}
+		index.tableLocks[i].RUnlock()
 	}
 }
 
 // perturb returns the result of applying perturbation on each baseKey.
-func (index *MultiprobeLsh) perturb(baseKey []hashTableKey, perturbation [][]int) []hashTableKey {
+func (index *MultiprobeIndexOf[P, K]) perturb(baseKey []hashTableKey, perturbation [][]int) []hashTableKey {
+	return perturbKeys(index.family, baseKey, perturbation)
+}
+
+// perturbKeys applies the perturbation vectors for each table to the
+// keys of the query point, by flipping bits for families of bit hashes
+// and by adding them otherwise.
+func perturbKeys[P any](family Family[P], baseKey []hashTableKey, perturbation [][]int) []hashTableKey {
 	if len(baseKey) != len(perturbation) {
 		panic("Number tables does not match with number of perturb vecs")
 	}
+	flip := hasBitHashes(family)
 	perturbedTableKeys := make([]hashTableKey, len(baseKey))
 	for i, p := range perturbation {
-		perturbedTableKeys[i] = make(hashTableKey, index.m)
+		perturbedTableKeys[i] = make(hashTableKey, len(baseKey[i]))
 		for j, h := range baseKey[i] {
-			perturbedTableKeys[i][j] = h + p[j]
+			if flip {
+				perturbedTableKeys[i][j] = h ^ p[j]
+			} else {
+				perturbedTableKeys[i][j] = h + p[j]
+			}
 		}
 	}
 	return perturbedTableKeys
 }
 
 // Query finds the ids of nearest neighbour candidates,
-// given the query point
-func (index *MultiprobeLsh) Query(q Point) []string {
+// given the query point.
+// It panics if the dimensionality of q does not match.
+func (index *MultiprobeIndexOf[P, K]) Query(q P) []K {
+	ids, err := index.TryQuery(q)
+	if err != nil {
+		panic(err)
+	}
+	return ids
+}
+
+// TryQuery finds the candidates like Query, but returns an error
+// wrapping ErrDimensionMismatch instead of panicking.
+func (index *MultiprobeIndexOf[P, K]) TryQuery(q P) ([]K, error) {
+	if err := checkDim(index.family, q); err != nil {
+		return nil, err
+	}
+	index.lock.RLock()
+	defer index.lock.RUnlock()
 	// Hash
-	baseKey := index.hash(q)
+	return index.query(queryKeys(index.family, q)), nil
+}
+
+// QueryBatch finds the candidates of each query point like Query,
+// hashing all the query points together.
+// It returns an error wrapping ErrDimensionMismatch if the
+// dimensionality of a query point does not match.
+func (index *MultiprobeIndexOf[P, K]) QueryBatch(queries []P) ([][]K, error) {
+	if err := checkBatch[P, K](index.family, queries, nil); err != nil {
+		return nil, err
+	}
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	results := make([][]K, len(queries))
+	for i, baseKey := range batchQueryKeys(index.family, queries) {
+		results[i] = index.query(baseKey)
+	}
+	return results, nil
+}
+
+// query returns the ids in the buckets of the probe sequence of the
+// keys baseKey. The lock must be held.
+func (index *MultiprobeIndexOf[P, K]) query(baseKey []hashTableKey) []K {
 	// Query
-	results := make(chan string)
+	results := make(chan K)
 	go func() {
 		defer close(results)
 		for i := 0; i < len(index.perturbVecs)+1; i++ {
@@ -257,7 +461,7 @@ func (index *MultiprobeLsh) Query(q Point) []string {
 			index.queryHelper(perturbedTableKeys, results)
 		}
 	}()
-	seen := make(map[string]bool)
+	seen := make(map[K]bool)
 	for id := range results {
 		if _, exist := seen[id]; exist {
 			continue
@@ -265,9 +469,147 @@ func (index *MultiprobeLsh) Query(q Point) []string {
 		seen[id] = true
 	}
 	// Collect results
-	ids := make([]string, 0, len(seen))
+	ids := make([]K, 0, len(seen))
 	for id := range seen {
 		ids = append(ids, id)
 	}
 	return ids
 }
+
+// QueryKNN finds the k nearest neighbours among the candidates
+// returned by Query, sorted by ascending exact distance to the query
+// point. The index must store vectors (see WithVectors).
+// It panics if the dimensionality of q does not match or if the index
+// does not store vectors.
+func (index *MultiprobeIndexOf[P, K]) QueryKNN(q P, k int) []NeighborOf[K] {
+	neighbors, err := index.TryQueryKNN(q, k)
+	if err != nil {
+		panic(err)
+	}
+	return neighbors
+}
+
+// TryQueryKNN finds the k nearest neighbours like QueryKNN, but
+// returns an error wrapping ErrDimensionMismatch or ErrNoVectors
+// instead of panicking.
+func (index *MultiprobeIndexOf[P, K]) TryQueryKNN(q P, k int) ([]NeighborOf[K], error) {
+	if err := checkVectors(index.family, index.points); err != nil {
+		return nil, err
+	}
+	candidates, err := index.TryQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	index.pointsLock.RLock()
+	defer index.pointsLock.RUnlock()
+	return rankNeighbors(index.family, index.points, q, candidates, k), nil
+}
+
+// QueryRadius finds the candidates returned by Query within distance
+// r of the query point, sorted by ascending exact distance.
+// The index must store vectors (see WithVectors).
+// It panics if the dimensionality of q does not match or if the index
+// does not store vectors.
+func (index *MultiprobeIndexOf[P, K]) QueryRadius(q P, r float64) []NeighborOf[K] {
+	neighbors, err := index.TryQueryRadius(q, r)
+	if err != nil {
+		panic(err)
+	}
+	return neighbors
+}
+
+// TryQueryRadius finds the candidates within distance r like
+// QueryRadius, but returns an error wrapping ErrDimensionMismatch or
+// ErrNoVectors instead of panicking.
+func (index *MultiprobeIndexOf[P, K]) TryQueryRadius(q P, r float64) ([]NeighborOf[K], error) {
+	if err := checkVectors(index.family, index.points); err != nil {
+		return nil, err
+	}
+	candidates, err := index.TryQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	index.pointsLock.RLock()
+	defer index.pointsLock.RUnlock()
+	return radiusNeighbors(index.family, index.points, q, candidates, r), nil
+}
+
+// WriteTo writes the LSH to w in a versioned and checksummed binary
+// format, including the hash functions, the perturbation vectors and
+// the stored vectors, and returns the number of bytes written.
+// It implements io.WriterTo.
+// Only the families of hash functions of this package and points of
+// type Point, BinaryPoint or []uint64 can be written.
+func (index *MultiprobeIndexOf[P, K]) WriteTo(w io.Writer) (int64, error) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	enc := newEncoder(w, kindMultiprobe, idKind[K]())
+	index.encode(enc)
+	enc.int(index.t)
+	encodePerturbVecs(enc, index.perturbVecs)
+	return enc.finish()
+}
+
+// encodePerturbVecs writes the perturbation vectors of all tables.
+func encodePerturbVecs(enc *encoder, perturbVecs [][][]int) {
+	enc.int(len(perturbVecs))
+	for _, perTableVecs := range perturbVecs {
+		for _, vec := range perTableVecs {
+			enc.ints(vec)
+		}
+	}
+}
+
+// decodePerturbVecs reads the perturbation vectors written by
+// encodePerturbVecs for l tables of m hash functions.
+func decodePerturbVecs(dec *decoder, l, m int) [][][]int {
+	n := dec.length()
+	var perturbVecs [][][]int
+	for i := 0; i < n && dec.err == nil; i++ {
+		perTableVecs := make([][]int, l)
+		for j := range perTableVecs {
+			perTableVecs[j] = dec.ints()
+			if dec.err == nil && len(perTableVecs[j]) != m {
+				dec.fail("expected perturbation vector of length %d, found %d", m, len(perTableVecs[j]))
+			}
+		}
+		perturbVecs = append(perturbVecs, perTableVecs)
+	}
+	return perturbVecs
+}
+
+// ReadFrom replaces the LSH with the one written by WriteTo to r, and
+// returns the number of bytes read. It implements io.ReaderFrom.
+// It returns an error wrapping ErrInvalidFormat if the data is
+// corrupt or was not written by a MultiprobeIndex of the same type.
+// ReadFrom buffers reads from r unless r is a *bufio.Reader, and must
+// not be called concurrently with other methods.
+func (index *MultiprobeIndexOf[P, K]) ReadFrom(r io.Reader) (int64, error) {
+	dec := newDecoder(r, kindMultiprobe, idKind[K]())
+	loaded := &MultiprobeIndexOf[P, K]{
+		BasicIndexOf: decodeBasic[P, K](dec),
+		t:            dec.length(),
+	}
+	if dec.err == nil {
+		if n := loaded.maxProbes(); loaded.t > n {
+			dec.fail("t = %d exceeds the %d perturbation sets", loaded.t, n)
+		}
+	}
+	if dec.err == nil {
+		loaded.perturbVecs = decodePerturbVecs(dec, len(loaded.tables), loaded.family.NumHashes())
+	}
+	if dec.err == nil && len(loaded.perturbVecs) != loaded.t {
+		dec.fail("expected %d perturbation vectors, found %d", loaded.t, len(loaded.perturbVecs))
+	}
+	if n, err := dec.finish(); err != nil {
+		return n, err
+	}
+	// Queries only use the perturbation vectors, the perturbation sets
+	// they were generated from are not needed.
+	index.BasicIndexOf = loaded.BasicIndexOf
+	index.t = loaded.t
+	index.scores = nil
+	index.perturbSets = nil
+	index.perturbVecs = loaded.perturbVecs
+	return dec.n, nil
+}
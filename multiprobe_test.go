@@ -45,3 +45,44 @@ func Test_MultiprobeLshQueryKnn(t *testing.T) {
 		}
 	}
 }
+
+func Test_MultiprobeLshQueryKNNRanked(t *testing.T) {
+	lsh := NewMultiprobeLsh(100, 5, 5, 50.0, 10, WithVectors())
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		checkNeighbors(t, lsh.QueryKNN(p, 3), p, points, strconv.Itoa(i), 3)
+	}
+}
+
+func Test_MultiprobeLshQueryRadius(t *testing.T) {
+	lsh := NewMultiprobeLsh(100, 5, 5, 50.0, 10, WithVectors())
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		checkRadius(t, lsh.QueryRadius(p, 130.0), p, points, strconv.Itoa(i), 130.0)
+	}
+}
+
+func Test_MultiprobeLshDelete(t *testing.T) {
+	lsh := NewMultiprobeLsh(100, 5, 5, 5.0, 10)
+	points := randomPoints(10, 100, 32.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		if err := lsh.Delete(strconv.Itoa(i)); err != nil {
+			t.Errorf("Delete fail: %v", err)
+		}
+		if contains(lsh.Query(p), strconv.Itoa(i)) {
+			t.Errorf("Failed to delete point %v.", i)
+		}
+	}
+	if err := lsh.Delete("0"); err == nil {
+		t.Error("Deleting an unknown id should return an error")
+	}
+}
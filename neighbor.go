@@ -0,0 +1,88 @@
+package lsh
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// NeighborOf is a point found by a k-NN or radius query on an index
+// with ids of type K.
+type NeighborOf[K ID] struct {
+	// ID is the unique identifier of the data point.
+	ID K
+	// Distance is the exact distance from the query point.
+	Distance float64
+}
+
+// Neighbor is a point found by a k-NN or radius query on an index with
+// string ids.
+type Neighbor = NeighborOf[string]
+
+// checkVectors returns an error wrapping ErrNoVectors if the index
+// does not store points, or errors.ErrUnsupported if family does not
+// measure distances.
+func checkVectors[P any, K ID](family Family[P], points map[K]P) error {
+	if points == nil {
+		return fmt.Errorf("%w: k-NN and radius queries require WithVectors", ErrNoVectors)
+	}
+	if _, ok := family.(MetricFamily[P]); !ok {
+		return fmt.Errorf("%w: k-NN and radius queries require a MetricFamily", errors.ErrUnsupported)
+	}
+	return nil
+}
+
+// measureNeighbors returns the candidate ids that are stored in
+// points, with their exact distances to q. The family and points must
+// pass checkVectors.
+func measureNeighbors[P any, K ID](family Family[P], points map[K]P, q P, ids []K) []NeighborOf[K] {
+	metric := family.(MetricFamily[P])
+	neighbors := make([]NeighborOf[K], 0, len(ids))
+	for _, id := range ids {
+		if point, exist := points[id]; exist {
+			neighbors = append(neighbors, NeighborOf[K]{id, metric.Distance(point, q)})
+		}
+	}
+	return neighbors
+}
+
+// sortNeighbors sorts neighbors by ascending distance.
+func sortNeighbors[K ID](neighbors []NeighborOf[K]) {
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].Distance != neighbors[j].Distance {
+			return neighbors[i].Distance < neighbors[j].Distance
+		}
+		return neighbors[i].ID < neighbors[j].ID
+	})
+}
+
+// withinRadius returns the neighbors at distance at most r.
+func withinRadius[K ID](neighbors []NeighborOf[K], r float64) []NeighborOf[K] {
+	within := make([]NeighborOf[K], 0, len(neighbors))
+	for _, n := range neighbors {
+		if n.Distance <= r {
+			within = append(within, n)
+		}
+	}
+	return within
+}
+
+// rankNeighbors returns the k nearest neighbours of q among the
+// candidate ids, sorted by ascending distance, using the stored points.
+// It returns no neighbours if k is not positive.
+func rankNeighbors[P any, K ID](family Family[P], points map[K]P, q P, ids []K, k int) []NeighborOf[K] {
+	neighbors := measureNeighbors(family, points, q, ids)
+	sortNeighbors(neighbors)
+	if len(neighbors) > k {
+		neighbors = neighbors[:max(k, 0)]
+	}
+	return neighbors
+}
+
+// radiusNeighbors returns the candidate ids within distance r of q,
+// sorted by ascending distance, using the stored points.
+func radiusNeighbors[P any, K ID](family Family[P], points map[K]P, q P, ids []K, r float64) []NeighborOf[K] {
+	neighbors := withinRadius(measureNeighbors(family, points, q, ids), r)
+	sortNeighbors(neighbors)
+	return neighbors
+}
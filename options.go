@@ -0,0 +1,99 @@
+package lsh
+
+import (
+	"math/rand"
+)
+
+// Option configures the indexes created by NewBasicLsh, NewLshForest,
+// NewMultiprobeLsh and their WithFamily variants, as well as the
+// families of hash functions.
+type Option func(*config)
+
+// config holds the settings applied by Options.
+type config struct {
+	// Distance metric of the p-stable LSH family.
+	metric Metric
+	// Whether the index keeps the inserted vectors.
+	vectors bool
+	// Source of randomness for the hash functions, nil for the
+	// default seed.
+	source rand.Source
+	// How Insert handles ids already in the index.
+	duplicates DuplicatePolicy
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		metric: L2,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// rand returns the random number generator for the hash functions.
+func (cfg *config) rand() *rand.Rand {
+	if cfg.source == nil {
+		return rand.New(rand.NewSource(rand_seed))
+	}
+	return rand.New(cfg.source)
+}
+
+// WithMetric selects the distance metric of the p-stable family of
+// LSH functions, either L2 (default) or L1. It has no effect on the
+// WithFamily constructors.
+func WithMetric(metric Metric) Option {
+	return func(cfg *config) {
+		cfg.metric = metric
+	}
+}
+
+// WithVectors makes the index keep a copy of every inserted vector,
+// which is required by QueryKNN to rank candidates by their exact
+// distances. It increases the memory used by the index.
+func WithVectors() Option {
+	return func(cfg *config) {
+		cfg.vectors = true
+	}
+}
+
+// DuplicatePolicy selects how Insert handles an id that is already
+// in the index.
+type DuplicatePolicy int
+
+const (
+	// AllowDuplicates inserts the point again under the same id, so
+	// the id can be returned for both points (default).
+	AllowDuplicates DuplicatePolicy = iota
+	// RejectDuplicates makes Insert fail with ErrDuplicateID.
+	RejectDuplicates
+	// ReplaceDuplicates makes Insert replace the existing entry, like
+	// Upsert.
+	ReplaceDuplicates
+)
+
+// WithDuplicatePolicy sets how Insert handles ids already in the
+// index. Policies other than AllowDuplicates serialize inserts.
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(cfg *config) {
+		cfg.duplicates = policy
+	}
+}
+
+// WithSeed sets the seed for generating the random hash functions,
+// so that indexes created with different seeds fail independently.
+// Indexes created with the same seed and parameters hash identically.
+func WithSeed(seed int64) Option {
+	return func(cfg *config) {
+		cfg.source = rand.NewSource(seed)
+	}
+}
+
+// WithRandSource sets the source of randomness for generating the
+// random hash functions. The source is only used during construction.
+func WithRandSource(source rand.Source) Option {
+	return func(cfg *config) {
+		cfg.source = source
+	}
+}
@@ -0,0 +1,40 @@
+package lsh
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func Test_WithSeed(t *testing.T) {
+	p := randomPoints(1, 100, 32.0)[0]
+	defaultKeys := hashKeys(NewBasicLsh(100, 5, 5, 5.0).family, p)
+	if !reflect.DeepEqual(defaultKeys, hashKeys(NewBasicLsh(100, 5, 5, 5.0, WithSeed(rand_seed)).family, p)) {
+		t.Error("Default seed should be kept for backward compatibility")
+	}
+	keys := hashKeys(NewBasicLsh(100, 5, 5, 5.0, WithSeed(42)).family, p)
+	if reflect.DeepEqual(defaultKeys, keys) {
+		t.Error("Different seeds should give different hash functions")
+	}
+	if !reflect.DeepEqual(keys, hashKeys(NewBasicLsh(100, 5, 5, 5.0, WithSeed(42)).family, p)) {
+		t.Error("Same seeds should give identical hash functions")
+	}
+	if !reflect.DeepEqual(keys, hashKeys(NewBasicLsh(100, 5, 5, 5.0, WithRandSource(rand.NewSource(42))).family, p)) {
+		t.Error("Rand source should be used for hash functions")
+	}
+	if reflect.DeepEqual(hashKeys(NewCosineFamily(100, 5, 5), p), hashKeys(NewCosineFamily(100, 5, 5, WithSeed(42)), p)) {
+		t.Error("Seed should be used by the cosine family")
+	}
+}
+
+func Test_MultiprobeWithSeed(t *testing.T) {
+	a := NewMultiprobeLsh(100, 5, 5, 5.0, 10, WithSeed(42))
+	b := NewMultiprobeLsh(100, 5, 5, 5.0, 10, WithSeed(42))
+	if !reflect.DeepEqual(a.perturbVecs, b.perturbVecs) {
+		t.Error("Same seeds should give identical perturbation vectors")
+	}
+	c := NewMultiprobeLsh(100, 5, 5, 5.0, 10, WithSeed(7))
+	if reflect.DeepEqual(a.perturbVecs, c.perturbVecs) {
+		t.Error("Different seeds should give different perturbation vectors")
+	}
+}
@@ -0,0 +1,151 @@
+package lsh
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrDimensionMismatch is the error returned by TryInsert and TryQuery
+// for points whose dimensionality differs from the index's. Insert and
+// Query panic with it.
+var ErrDimensionMismatch = errors.New("lsh: dimension mismatch")
+
+// ErrInvalidPoint is the error returned by TryInsert and TryQuery for
+// malformed points, such as a SparsePoint whose indices are not
+// increasing.
+var ErrInvalidPoint = errors.New("lsh: invalid point")
+
+// ErrNoVectors is the error returned by TryQueryKNN and TryQueryRadius
+// for indexes that do not store vectors, see WithVectors. QueryKNN and
+// QueryRadius panic with it.
+var ErrNoVectors = errors.New("lsh: vectors not stored")
+
+// ErrNotFound is the error returned when deleting an id that is not
+// in the index.
+var ErrNotFound = errors.New("lsh: id not found")
+
+// ErrDuplicateID is the error returned when inserting an id that is
+// already in an index using RejectDuplicates.
+var ErrDuplicateID = errors.New("lsh: duplicate id")
+
+// ErrInvalidFormat is the error returned by ReadFrom for data that
+// is corrupt, truncated or was not written by WriteTo of the same
+// index type.
+var ErrInvalidFormat = errors.New("lsh: invalid format")
+
+// ErrInvalidParams is the error returned by the FromParams
+// constructors for invalid parameters or options.
+var ErrInvalidParams = errors.New("lsh: invalid parameters")
+
+// Params are the parameters of the indexes using the p-stable family
+// of LSH functions, for the constructors NewBasicLshFromParams,
+// NewLshForestFromParams and NewMultiprobeLshFromParams.
+type Params struct {
+	// Dim is the dimensionality of the data.
+	Dim int
+	// L is the number of hash tables.
+	L int
+	// M is the number of hash values to concatenate to form the
+	// key to the hash tables.
+	M int
+	// W is the slot size for the family of LSH functions.
+	W float64
+	// T is the number of perturbation vectors applied to each query,
+	// only used by Multi-probe LSH.
+	T int
+}
+
+// Validate returns an error wrapping ErrInvalidParams describing the
+// first invalid parameter, or nil if all parameters are valid.
+// T must not exceed the 3^M-1 valid perturbation sets.
+func (params Params) Validate() error {
+	switch {
+	case params.Dim <= 0:
+		return fmt.Errorf("%w: dim must be positive, got %d", ErrInvalidParams, params.Dim)
+	case params.L <= 0:
+		return fmt.Errorf("%w: l must be positive, got %d", ErrInvalidParams, params.L)
+	case params.M <= 0:
+		return fmt.Errorf("%w: m must be positive, got %d", ErrInvalidParams, params.M)
+	case !(params.W > 0) || math.IsInf(params.W, 1):
+		return fmt.Errorf("%w: w must be positive and finite, got %v", ErrInvalidParams, params.W)
+	case params.T < 0:
+		return fmt.Errorf("%w: t must not be negative, got %d", ErrInvalidParams, params.T)
+	case params.T > numPerturbSets(params.M):
+		return fmt.Errorf("%w: t = %d exceeds the %d valid perturbation sets for m = %d",
+			ErrInvalidParams, params.T, numPerturbSets(params.M), params.M)
+	}
+	return nil
+}
+
+// numPerturbSets returns the number of valid perturbation sets of
+// Multi-probe LSH for m hash values, 3^m-1, capped at math.MaxInt.
+func numPerturbSets(m int) int {
+	n := 1
+	for i := 0; i < m; i++ {
+		if n > math.MaxInt/3 {
+			return math.MaxInt
+		}
+		n *= 3
+	}
+	return n - 1
+}
+
+// checkDim returns an error wrapping ErrDimensionMismatch if point
+// does not have the dimensionality of the family.
+func checkDim[P any](family Family[P], point P) error {
+	dim := family.Dim()
+	switch p := any(point).(type) {
+	case Point:
+		if len(p) != dim {
+			return fmt.Errorf("%w: expected %d, got %d", ErrDimensionMismatch, dim, len(p))
+		}
+	case Point32:
+		if len(p) != dim {
+			return fmt.Errorf("%w: expected %d, got %d", ErrDimensionMismatch, dim, len(p))
+		}
+	case SparsePoint:
+		if len(p.Indices) != len(p.Values) {
+			return fmt.Errorf("%w: %d indices but %d values", ErrInvalidPoint, len(p.Indices), len(p.Values))
+		}
+		for i, d := range p.Indices {
+			if d < 0 || d >= dim {
+				return fmt.Errorf("%w: index %d out of range for %d dimensions", ErrDimensionMismatch, d, dim)
+			}
+			if i > 0 && d <= p.Indices[i-1] {
+				return fmt.Errorf("%w: indices not increasing at %d", ErrInvalidPoint, i)
+			}
+		}
+	case BinaryPoint:
+		if words := (dim + 63) / 64; len(p) != words {
+			return fmt.Errorf("%w: expected %d words for %d bits, got %d",
+				ErrDimensionMismatch, words, dim, len(p))
+		}
+	}
+	return nil
+}
+
+// validate returns an error wrapping ErrInvalidParams if an option
+// has an invalid value.
+func (cfg *config) validate() error {
+	if cfg.metric != L2 && cfg.metric != L1 {
+		return fmt.Errorf("%w: unknown metric %d", ErrInvalidParams, cfg.metric)
+	}
+	if cfg.duplicates < AllowDuplicates || cfg.duplicates > ReplaceDuplicates {
+		return fmt.Errorf("%w: unknown duplicate policy %d", ErrInvalidParams, cfg.duplicates)
+	}
+	return nil
+}
+
+// newLshParamsFromParams validates params and opts and creates the
+// p-stable family of LSH functions.
+func newLshParamsFromParams(params Params, opts []Option) (*lshParams[float64], error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return newLshParams[float64](params.Dim, params.L, params.M, params.W, cfg.metric, cfg.rand()), nil
+}
@@ -0,0 +1,123 @@
+package lsh
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func Test_ParamsValidate(t *testing.T) {
+	valid := Params{Dim: 100, L: 5, M: 5, W: 5.0, T: 10}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Valid params rejected: %v", err)
+	}
+	for _, params := range []Params{
+		{Dim: 0, L: 5, M: 5, W: 5.0},
+		{Dim: 100, L: 0, M: 5, W: 5.0},
+		{Dim: 100, L: 5, M: -1, W: 5.0},
+		{Dim: 100, L: 5, M: 5, W: 0},
+		{Dim: 100, L: 5, M: 5, W: math.NaN()},
+		{Dim: 100, L: 5, M: 5, W: math.Inf(1)},
+		{Dim: 100, L: 5, M: 5, W: 5.0, T: -1},
+	} {
+		err := params.Validate()
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Invalid params %+v accepted: %v", params, err)
+		}
+		if _, err := NewBasicLshFromParams(params); err == nil {
+			t.Errorf("NewBasicLshFromParams accepted %+v", params)
+		}
+		if _, err := NewLshForestFromParams(params); err == nil {
+			t.Errorf("NewLshForestFromParams accepted %+v", params)
+		}
+		if _, err := NewMultiprobeLshFromParams(params); err == nil {
+			t.Errorf("NewMultiprobeLshFromParams accepted %+v", params)
+		}
+	}
+	if _, err := NewBasicLshFromParams(valid, WithMetric(Metric(7))); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("Unknown metric accepted: %v", err)
+	}
+}
+
+func Test_NewFromParams(t *testing.T) {
+	params := Params{Dim: 100, L: 5, M: 5, W: 5.0, T: 10}
+	if lsh, err := NewBasicLshFromParams(params); err != nil || len(lsh.tables) != 5 {
+		t.Errorf("NewBasicLshFromParams fail: %v", err)
+	}
+	if lsh, err := NewLshForestFromParams(params); err != nil || len(lsh.trees) != 5 {
+		t.Errorf("NewLshForestFromParams fail: %v", err)
+	}
+	lsh, err := NewMultiprobeLshFromParams(params)
+	if err != nil || len(lsh.perturbVecs) != 10 {
+		t.Errorf("NewMultiprobeLshFromParams fail: %v", err)
+	}
+	// There are 3^m-1 valid perturbation sets.
+	params.M, params.T = 3, 26
+	if _, err := NewMultiprobeLshFromParams(params); err != nil {
+		t.Errorf("NewMultiprobeLshFromParams rejected t = 26 for m = 3: %v", err)
+	}
+	params.T = 27
+	if _, err := NewMultiprobeLshFromParams(params); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("NewMultiprobeLshFromParams accepted t = 27 for m = 3: %v", err)
+	}
+	if err := params.Validate(); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("Validate accepted t = 27 for m = 3: %v", err)
+	}
+	// The bound is checked before searching the perturbation sets.
+	params.M, params.T = 100, math.MaxInt
+	if err := params.Validate(); err != nil {
+		t.Errorf("Validate rejected t = MaxInt for m = 100: %v", err)
+	}
+	params.M, params.T = 10, 60000
+	if _, err := NewMultiprobeLshFromParams(params); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("NewMultiprobeLshFromParams accepted t = 60000 for m = 10: %v", err)
+	}
+}
+
+func Test_DimensionMismatch(t *testing.T) {
+	basic := NewBasicLsh(10, 2, 2, 5.0)
+	forest := NewLshForest(10, 2, 2, 5.0)
+	multiprobe := NewMultiprobeLsh(10, 2, 2, 5.0, 2)
+	for _, p := range []Point{make(Point, 9), make(Point, 11)} {
+		if err := basic.TryInsert(p, "a"); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("BasicLsh TryInsert accepted %d dimensions: %v", len(p), err)
+		}
+		if err := forest.TryInsert(p, "a"); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("LshForest TryInsert accepted %d dimensions: %v", len(p), err)
+		}
+		if err := multiprobe.TryInsert(p, "a"); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("MultiprobeLsh TryInsert accepted %d dimensions: %v", len(p), err)
+		}
+		if _, err := basic.TryQuery(p); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("BasicLsh TryQuery accepted %d dimensions: %v", len(p), err)
+		}
+		if _, err := forest.TryQuery(p, 1); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("LshForest TryQuery accepted %d dimensions: %v", len(p), err)
+		}
+		if _, err := multiprobe.TryQuery(p); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("MultiprobeLsh TryQuery accepted %d dimensions: %v", len(p), err)
+		}
+	}
+	if err := basic.TryInsert(make(Point, 10), "a"); err != nil {
+		t.Errorf("TryInsert rejected matching dimensions: %v", err)
+	}
+	if ids, err := basic.TryQuery(make(Point, 10)); err != nil || len(ids) != 1 {
+		t.Errorf("TryQuery fail: %v %v", ids, err)
+	}
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("Insert should panic with ErrDimensionMismatch, got %v", err)
+		}
+	}()
+	basic.Insert(make(Point, 9), "b")
+}
+
+func Test_BinaryDimensionMismatch(t *testing.T) {
+	lsh := NewBasicLshWithFamily(NewHammingFamily(100, 2, 4))
+	if err := lsh.TryInsert(make(BinaryPoint, 2), "a"); err != nil {
+		t.Errorf("TryInsert rejected 2 words for 100 bits: %v", err)
+	}
+	if err := lsh.TryInsert(make(BinaryPoint, 1), "b"); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("TryInsert accepted 1 word for 100 bits: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package lsh
+
+import (
+	"fmt"
+	"math"
+)
+
+// CollisionProbability returns the probability that a p-stable LSH
+// function with slot size w hashes two points at distance r to the
+// same value, as derived by Datar et.al. It decreases with r, from 1
+// at distance 0. It returns NaN if w is not positive or r is negative.
+func (metric Metric) CollisionProbability(w, r float64) float64 {
+	if !(w > 0 && r >= 0) {
+		return math.NaN()
+	}
+	if r == 0 {
+		return 1
+	}
+	t := w / r
+	if metric == L1 {
+		return 2*math.Atan(t)/math.Pi - math.Log1p(t*t)/(math.Pi*t)
+	}
+	return math.Erf(t/math.Sqrt2) + 2/(math.Sqrt(2*math.Pi)*t)*math.Expm1(-t*t/2)
+}
+
+// CandidateProbability returns the probability that two points whose
+// hash values collide with probability p, such as given by
+// CollisionProbability, share the key of at least one of l hash
+// tables with m hash values per key, that is 1-(1-p^m)^l. The
+// probability of missing a neighbour at that distance is one minus it.
+// It returns NaN if p is not in [0, 1].
+func CandidateProbability(p float64, l, m int) float64 {
+	if !(p >= 0 && p <= 1) {
+		return math.NaN()
+	}
+	return -math.Expm1(float64(l) * math.Log1p(-math.Pow(p, float64(m))))
+}
+
+// NumTables returns the smallest number of hash tables with m hash
+// values per key for which two points whose hash values collide with
+// probability p fail to share a key with probability at most
+// falseNegative, the inverse of CandidateProbability.
+// It returns an error wrapping ErrInvalidParams if p is not in [0, 1],
+// if falseNegative is not in (0, 1), or if p^m is too small for any
+// number of tables.
+func NumTables(p float64, m int, falseNegative float64) (int, error) {
+	if !(p >= 0 && p <= 1) {
+		return 0, fmt.Errorf("%w: collision probability must be in [0, 1], got %v", ErrInvalidParams, p)
+	}
+	if !(falseNegative > 0 && falseNegative < 1) {
+		return 0, fmt.Errorf("%w: false negative rate must be in (0, 1), got %v", ErrInvalidParams, falseNegative)
+	}
+	pm := math.Pow(p, float64(m))
+	if pm >= 1 {
+		return 1, nil
+	}
+	l := math.Ceil(math.Log(falseNegative) / math.Log1p(-pm))
+	if !(pm > 0) || l > math.MaxInt32 {
+		return 0, fmt.Errorf("%w: collision probability %v is too small for %d hash values", ErrInvalidParams, p, m)
+	}
+	return int(l), nil
+}
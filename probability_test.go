@@ -0,0 +1,68 @@
+package lsh
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func Test_CollisionProbability(t *testing.T) {
+	const l, w = 4000, 4.0
+	for metric, family := range map[Metric]HashFamily{
+		L2: NewL2Family(10, l, 1, w),
+		L1: NewL1Family(10, l, 1, w),
+	} {
+		for _, r := range []float64{0.5, 2, 4, 10} {
+			p := make(Point, 10)
+			q := slices.Clone(p)
+			q[3] = r
+			collisions := 0
+			for i := 0; i < l; i++ {
+				if family.Hash(p, i)[0] == family.Hash(q, i)[0] {
+					collisions++
+				}
+			}
+			want := metric.CollisionProbability(w, r)
+			if got := float64(collisions) / l; math.Abs(got-want) > 0.03 {
+				t.Errorf("Metric %d, r=%v: expected collision probability %.3f, got %.3f", metric, r, want, got)
+			}
+		}
+		if p := metric.CollisionProbability(w, 0); p != 1 {
+			t.Errorf("Expected probability 1 at distance 0, got %v", p)
+		}
+		if !math.IsNaN(metric.CollisionProbability(0, 1)) || !math.IsNaN(metric.CollisionProbability(w, -1)) {
+			t.Error("Expected NaN for w <= 0 or r < 0")
+		}
+	}
+}
+
+func Test_NumTables(t *testing.T) {
+	p := L2.CollisionProbability(4, 1)
+	if got, want := CandidateProbability(p, 1, 1), p; math.Abs(got-want) > 1e-12 {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	for _, m := range []int{1, 5, 10} {
+		l, err := NumTables(p, m, 0.05)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if CandidateProbability(p, l, m) < 0.95 || CandidateProbability(p, l-1, m) >= 0.95 {
+			t.Errorf("m=%d: %d tables is not the least reaching 0.95", m, l)
+		}
+	}
+	if !math.IsNaN(CandidateProbability(1.5, 1, 1)) || !math.IsNaN(CandidateProbability(-0.5, 1, 1)) {
+		t.Error("Expected NaN for p outside [0, 1]")
+	}
+	if l, err := NumTables(1, 10, 0.05); err != nil || l != 1 {
+		t.Errorf("Expected 1 table, got %d, %v", l, err)
+	}
+	for _, args := range []struct {
+		p, rate float64
+		m       int
+	}{{0.5, 0, 5}, {0.5, 1, 5}, {0, 0.1, 5}, {1e-6, 0.1, 100}, {-0.5, 0.1, 2}, {1.5, 0.1, 2}} {
+		if _, err := NumTables(args.p, args.m, args.rate); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Expected ErrInvalidParams for %+v, got %v", args, err)
+		}
+	}
+}
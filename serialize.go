@@ -0,0 +1,702 @@
+package lsh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+)
+
+// The binary format written by WriteTo starts with formatMagic, the
+// format version, the kind of index and the kind of ids, followed by
+// the family of hash functions, the contents of the index and a
+// CRC-32 (IEEE) of all the preceding bytes. Integers and floats are
+// 64-bit little endian, except the elements of float32 vectors, which
+// are 32-bit, and slices and strings are prefixed with their length.
+const (
+	formatMagic   = "LSH\x00"
+	formatVersion = 3
+)
+
+// Kinds of indexes.
+const (
+	kindBasic = iota + 1
+	kindForest
+	kindMultiprobe
+	kindFrozen
+)
+
+var kindNames = map[int]string{
+	kindBasic:      "basic",
+	kindForest:     "forest",
+	kindMultiprobe: "multiprobe",
+	kindFrozen:     "frozen",
+}
+
+// Kinds of families of hash functions.
+const (
+	familyLsh = iota + 1
+	familySimhash
+	familyBitSampling
+	familyMinhash
+	familyMips
+	familyLsh32
+	familySimhash32
+	familySparseLsh
+	familySparseSimhash
+)
+
+// maxChunk bounds the allocations made before reading the data they
+// hold, so that a corrupt length fails with an error rather than
+// exhausting memory.
+const maxChunk = 1 << 16
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// encoder writes the binary format, keeping the first error.
+type encoder struct {
+	count *countWriter
+	w     *bufio.Writer
+	crc   hash.Hash32
+	err   error
+	buf   [8]byte
+}
+
+// newEncoder creates an encoder writing to w, and writes the header
+// for the kind of index and of ids.
+func newEncoder(w io.Writer, kind, idKind int) *encoder {
+	count := &countWriter{w: w}
+	enc := &encoder{
+		count: count,
+		w:     bufio.NewWriter(count),
+		crc:   crc32.NewIEEE(),
+	}
+	enc.write([]byte(formatMagic))
+	enc.int(formatVersion)
+	enc.int(kind)
+	enc.int(idKind)
+	return enc
+}
+
+func (enc *encoder) fail(err error) {
+	if enc.err == nil {
+		enc.err = err
+	}
+}
+
+func (enc *encoder) write(p []byte) {
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.Write(p)
+	enc.crc.Write(p)
+}
+
+func (enc *encoder) bool(v bool) {
+	if v {
+		enc.write([]byte{1})
+	} else {
+		enc.write([]byte{0})
+	}
+}
+
+func (enc *encoder) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(enc.buf[:], v)
+	enc.write(enc.buf[:])
+}
+
+func (enc *encoder) int(v int) {
+	enc.uint64(uint64(v))
+}
+
+func (enc *encoder) float64(v float64) {
+	enc.uint64(math.Float64bits(v))
+}
+
+func (enc *encoder) string(s string) {
+	enc.int(len(s))
+	enc.write([]byte(s))
+}
+
+func (enc *encoder) ints(v []int) {
+	enc.int(len(v))
+	for _, x := range v {
+		enc.int(x)
+	}
+}
+
+func (enc *encoder) uint64s(v []uint64) {
+	enc.int(len(v))
+	for _, x := range v {
+		enc.uint64(x)
+	}
+}
+
+func (enc *encoder) float64s(v []float64) {
+	enc.int(len(v))
+	for _, x := range v {
+		enc.float64(x)
+	}
+}
+
+func (enc *encoder) float32s(v []float32) {
+	enc.int(len(v))
+	for _, x := range v {
+		enc.uint32(math.Float32bits(x))
+	}
+}
+
+// encodeVector writes a vector of float64 or float32 elements.
+func encodeVector[F Float](enc *encoder, v []F) {
+	switch v := any(v).(type) {
+	case []float64:
+		enc.float64s(v)
+	case []float32:
+		enc.float32s(v)
+	}
+}
+
+func (enc *encoder) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(enc.buf[:4], v)
+	enc.write(enc.buf[:4])
+}
+
+// offset returns the number of bytes written so far.
+func (enc *encoder) offset() int64 {
+	return enc.count.n + int64(enc.w.Buffered())
+}
+
+// align writes zero bytes up to the next multiple of 8 bytes.
+func (enc *encoder) align() {
+	if pad := (8 - enc.offset()%8) % 8; pad > 0 {
+		enc.write(make([]byte, pad))
+	}
+}
+
+// checksum writes the CRC-32 of all the bytes written so far.
+func (enc *encoder) checksum() {
+	if enc.err == nil {
+		binary.LittleEndian.PutUint32(enc.buf[:4], enc.crc.Sum32())
+		_, enc.err = enc.w.Write(enc.buf[:4])
+	}
+}
+
+// flush flushes the output and returns the number of bytes written
+// and the first error.
+func (enc *encoder) flush() (int64, error) {
+	if enc.err == nil {
+		enc.err = enc.w.Flush()
+	}
+	return enc.count.n, enc.err
+}
+
+// finish writes the checksum, flushes the output and returns the
+// number of bytes written and the first error.
+func (enc *encoder) finish() (int64, error) {
+	enc.checksum()
+	return enc.flush()
+}
+
+// decoder reads the binary format, keeping the first error.
+type decoder struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	n   int64
+	err error
+	buf [8]byte
+}
+
+// newDecoder creates a decoder reading from r, and reads the header
+// expecting the kind of index and of ids.
+func newDecoder(r io.Reader, kind, idKind int) *decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	dec := &decoder{
+		r:   br,
+		crc: crc32.NewIEEE(),
+	}
+	magic := make([]byte, len(formatMagic))
+	if dec.read(magic) && string(magic) != formatMagic {
+		dec.fail("not an index")
+	}
+	if version := dec.int(); dec.err == nil && version != formatVersion {
+		dec.fail("unsupported version %d", version)
+	}
+	if found := dec.int(); dec.err == nil && found != kind {
+		dec.fail("expected %s index, found %s index", kindNames[kind], kindNames[found])
+	}
+	if found := dec.int(); dec.err == nil && found != idKind {
+		dec.fail("expected %s ids, found %s ids", idKindNames[idKind], idKindNames[found])
+	}
+	return dec
+}
+
+func (dec *decoder) fail(format string, args ...any) {
+	if dec.err == nil {
+		dec.err = fmt.Errorf("%w: "+format, append([]any{ErrInvalidFormat}, args...)...)
+	}
+}
+
+func (dec *decoder) read(p []byte) bool {
+	if dec.err != nil {
+		return false
+	}
+	n, err := io.ReadFull(dec.r, p)
+	dec.crc.Write(p[:n])
+	dec.n += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("%w: %w", ErrInvalidFormat, io.ErrUnexpectedEOF)
+	}
+	dec.err = err
+	return err == nil
+}
+
+func (dec *decoder) bool() bool {
+	if !dec.read(dec.buf[:1]) {
+		return false
+	}
+	if dec.buf[0] > 1 {
+		dec.fail("invalid bool %d", dec.buf[0])
+	}
+	return dec.buf[0] == 1
+}
+
+func (dec *decoder) uint64() uint64 {
+	if !dec.read(dec.buf[:]) {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(dec.buf[:])
+}
+
+func (dec *decoder) int() int {
+	return int(dec.uint64())
+}
+
+func (dec *decoder) float64() float64 {
+	return math.Float64frombits(dec.uint64())
+}
+
+// length reads a length, which must not be negative.
+func (dec *decoder) length() int {
+	n := dec.int()
+	if n < 0 {
+		dec.fail("negative length %d", n)
+		return 0
+	}
+	return n
+}
+
+func (dec *decoder) string() string {
+	n := dec.length()
+	b := make([]byte, 0, min(n, maxChunk))
+	for len(b) < n && dec.err == nil {
+		chunk := min(n-len(b), maxChunk)
+		b = append(b, make([]byte, chunk)...)
+		dec.read(b[len(b)-chunk:])
+	}
+	return string(b)
+}
+
+func (dec *decoder) ints() []int {
+	n := dec.length()
+	v := make([]int, 0, min(n, maxChunk))
+	for len(v) < n && dec.err == nil {
+		v = append(v, dec.int())
+	}
+	return v
+}
+
+func (dec *decoder) uint64s() []uint64 {
+	n := dec.length()
+	v := make([]uint64, 0, min(n, maxChunk))
+	for len(v) < n && dec.err == nil {
+		v = append(v, dec.uint64())
+	}
+	return v
+}
+
+func (dec *decoder) float64s() []float64 {
+	n := dec.length()
+	v := make([]float64, 0, min(n, maxChunk))
+	for len(v) < n && dec.err == nil {
+		v = append(v, dec.float64())
+	}
+	return v
+}
+
+func (dec *decoder) float32s() []float32 {
+	n := dec.length()
+	v := make([]float32, 0, min(n, maxChunk))
+	for len(v) < n && dec.err == nil && dec.read(dec.buf[:4]) {
+		v = append(v, math.Float32frombits(binary.LittleEndian.Uint32(dec.buf[:4])))
+	}
+	return v
+}
+
+// decodeVector reads a vector written by encodeVector.
+func decodeVector[F Float](dec *decoder) Vector[F] {
+	var v Vector[F]
+	switch p := any(&v).(type) {
+	case *Vector[float64]:
+		*p = dec.float64s()
+	case *Vector[float32]:
+		*p = dec.float32s()
+	}
+	return v
+}
+
+// finish reads and verifies the checksum, and returns the number of
+// bytes read and the first error.
+func (dec *decoder) finish() (int64, error) {
+	sum := dec.crc.Sum32()
+	if dec.read(dec.buf[:4]) && binary.LittleEndian.Uint32(dec.buf[:4]) != sum {
+		dec.fail("checksum mismatch")
+	}
+	return dec.n, dec.err
+}
+
+// encodeFamily writes a family of hash functions of this package.
+func encodeFamily(enc *encoder, family any) {
+	switch f := family.(type) {
+	case *lshParams[float64]:
+		encodeLshParams(enc, familyLsh, f)
+	case *lshParams[float32]:
+		encodeLshParams(enc, familyLsh32, f)
+	case *simhashParams[float64]:
+		encodeSimhashParams(enc, familySimhash, f)
+	case *simhashParams[float32]:
+		encodeSimhashParams(enc, familySimhash32, f)
+	case *sparseLshParams:
+		enc.int(familySparseLsh)
+		enc.int(f.dim)
+		enc.int(f.l)
+		enc.int(f.m)
+		enc.float64(f.w)
+		enc.int(int(f.metric))
+		enc.uint64(f.seed)
+		for i := range f.b {
+			enc.float64s(f.b[i])
+		}
+	case *sparseSimhashParams:
+		enc.int(familySparseSimhash)
+		enc.int(f.dim)
+		enc.int(f.l)
+		enc.int(f.m)
+		enc.uint64(f.seed)
+	case *bitSamplingParams:
+		enc.int(familyBitSampling)
+		enc.int(f.dim)
+		enc.int(f.l)
+		enc.int(f.m)
+		for i := range f.positions {
+			enc.ints(f.positions[i])
+		}
+	case *minhashParams:
+		enc.int(familyMinhash)
+		enc.int(f.b)
+		enc.int(f.r)
+		enc.uint64s(f.minhash.seeds)
+	case *mipsParams:
+		enc.int(familyMips)
+		enc.float64(f.maxNorm)
+		encodeFamily(enc, f.family)
+	default:
+		enc.fail(fmt.Errorf("%w: family %T", errors.ErrUnsupported, family))
+	}
+}
+
+func encodeLshParams[F Float](enc *encoder, kind int, f *lshParams[F]) {
+	enc.int(kind)
+	enc.int(f.dim)
+	enc.int(f.l)
+	enc.int(f.m)
+	enc.float64(f.w)
+	enc.int(int(f.metric))
+	for i := range f.a {
+		for j := range f.a[i] {
+			encodeVector(enc, f.a[i][j])
+		}
+		enc.float64s(f.b[i])
+	}
+}
+
+func encodeSimhashParams[F Float](enc *encoder, kind int, f *simhashParams[F]) {
+	enc.int(kind)
+	enc.int(f.dim)
+	enc.int(f.l)
+	enc.int(f.m)
+	for i := range f.a {
+		for j := range f.a[i] {
+			encodeVector(enc, f.a[i][j])
+		}
+	}
+}
+
+// decodeShape reads the dimensionality, number of tables and number
+// of hash functions of a family, and validates them.
+func decodeShape(dec *decoder) (dim, l, m int) {
+	dim, l, m = dec.length(), dec.length(), dec.length()
+	if dec.err == nil && (dim <= 0 || l <= 0 || m <= 0) {
+		dec.fail("invalid family shape dim=%d l=%d m=%d", dim, l, m)
+	}
+	return dim, l, m
+}
+
+// decodeVectors reads l x m vectors of length dim.
+func decodeVectors[F Float](dec *decoder, l, m, dim int, b *[][]float64) [][]Vector[F] {
+	a := make([][]Vector[F], 0, min(l, maxChunk))
+	for i := 0; i < l && dec.err == nil; i++ {
+		vecs := make([]Vector[F], 0, min(m, maxChunk))
+		for j := 0; j < m && dec.err == nil; j++ {
+			vecs = append(vecs, decodeVector[F](dec))
+			if dec.err == nil && len(vecs[j]) != dim {
+				dec.fail("expected vector of length %d, found %d", dim, len(vecs[j]))
+			}
+		}
+		a = append(a, vecs)
+		if b != nil {
+			*b = append(*b, dec.float64s())
+			if dec.err == nil && len((*b)[i]) != m {
+				dec.fail("expected %d offsets, found %d", m, len((*b)[i]))
+			}
+		}
+	}
+	return a
+}
+
+// decodeFamily reads a family of hash functions written by
+// encodeFamily.
+func decodeFamily(dec *decoder) any {
+	switch kind := dec.int(); kind {
+	case familyLsh:
+		return decodeLshParams[float64](dec)
+	case familyLsh32:
+		return decodeLshParams[float32](dec)
+	case familySimhash:
+		return decodeSimhashParams[float64](dec)
+	case familySimhash32:
+		return decodeSimhashParams[float32](dec)
+	case familySparseLsh:
+		f := &sparseLshParams{}
+		f.dim, f.l, f.m = decodeShape(dec)
+		f.w = dec.float64()
+		f.metric = Metric(dec.int())
+		f.seed = dec.uint64()
+		if dec.err == nil && (f.w <= 0 || math.IsInf(f.w, 0) || math.IsNaN(f.w)) {
+			dec.fail("invalid slot size %v", f.w)
+		}
+		if dec.err == nil && f.metric != L2 && f.metric != L1 {
+			dec.fail("unknown metric %d", f.metric)
+		}
+		f.b = make([][]float64, 0, min(f.l, maxChunk))
+		for i := 0; i < f.l && dec.err == nil; i++ {
+			f.b = append(f.b, dec.float64s())
+			if dec.err == nil && len(f.b[i]) != f.m {
+				dec.fail("expected %d offsets, found %d", f.m, len(f.b[i]))
+			}
+		}
+		return f
+	case familySparseSimhash:
+		f := &sparseSimhashParams{}
+		f.dim, f.l, f.m = decodeShape(dec)
+		f.seed = dec.uint64()
+		return f
+	case familyBitSampling:
+		f := &bitSamplingParams{}
+		f.dim, f.l, f.m = decodeShape(dec)
+		f.positions = make([][]int, 0, min(f.l, maxChunk))
+		for i := 0; i < f.l && dec.err == nil; i++ {
+			positions := dec.ints()
+			if dec.err == nil && len(positions) != f.m {
+				dec.fail("expected %d bit positions, found %d", f.m, len(positions))
+			}
+			for _, pos := range positions {
+				if dec.err == nil && (pos < 0 || pos >= f.dim) {
+					dec.fail("bit position %d out of range", pos)
+				}
+			}
+			f.positions = append(f.positions, positions)
+		}
+		return f
+	case familyMinhash:
+		f := &minhashParams{
+			b: dec.length(),
+			r: dec.length(),
+		}
+		f.minhash = &Minhash{
+			seeds: dec.uint64s(),
+		}
+		if dec.err == nil && (f.b <= 0 || f.r <= 0 || len(f.minhash.seeds) != f.b*f.r) {
+			dec.fail("invalid minhash shape b=%d r=%d seeds=%d", f.b, f.r, len(f.minhash.seeds))
+		}
+		return f
+	case familyMips:
+		f := &mipsParams{
+			maxNorm: dec.float64(),
+		}
+		family, ok := decodeFamily(dec).(HashFamily)
+		if dec.err == nil && !ok {
+			dec.fail("invalid family for maximum inner product search")
+		}
+		f.family = family
+		return f
+	default:
+		dec.fail("unknown family %d", kind)
+		return nil
+	}
+}
+
+func decodeLshParams[F Float](dec *decoder) *lshParams[F] {
+	f := &lshParams[F]{}
+	f.dim, f.l, f.m = decodeShape(dec)
+	f.w = dec.float64()
+	f.metric = Metric(dec.int())
+	if dec.err == nil && (f.w <= 0 || math.IsInf(f.w, 0) || math.IsNaN(f.w)) {
+		dec.fail("invalid slot size %v", f.w)
+	}
+	if dec.err == nil && f.metric != L2 && f.metric != L1 {
+		dec.fail("unknown metric %d", f.metric)
+	}
+	f.a = decodeVectors[F](dec, f.l, f.m, f.dim, &f.b)
+	f.matrix = packVectors(f.a, f.dim)
+	return f
+}
+
+func decodeSimhashParams[F Float](dec *decoder) *simhashParams[F] {
+	f := &simhashParams[F]{}
+	f.dim, f.l, f.m = decodeShape(dec)
+	f.a = decodeVectors[F](dec, f.l, f.m, f.dim, nil)
+	f.matrix = packVectors(f.a, f.dim)
+	return f
+}
+
+// decodeTypedFamily reads a family of hash functions for inputs of
+// type P, and checks that it has l tables.
+func decodeTypedFamily[P any](dec *decoder) Family[P] {
+	f := decodeFamily(dec)
+	if dec.err != nil {
+		return nil
+	}
+	family, ok := f.(Family[P])
+	if !ok {
+		var point P
+		dec.fail("family %T does not hash %T", f, point)
+	}
+	return family
+}
+
+// encodePoints writes the stored points of an index, if any.
+func encodePoints[P any, K ID](enc *encoder, points map[K]P) {
+	enc.bool(points != nil)
+	if points == nil {
+		return
+	}
+	ids := make([]K, 0, len(points))
+	for id := range points {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	enc.int(len(ids))
+	for _, id := range ids {
+		encodeID(enc, id)
+		switch p := any(points[id]).(type) {
+		case Point:
+			enc.float64s(p)
+		case Point32:
+			enc.float32s(p)
+		case SparsePoint:
+			enc.ints(p.Indices)
+			enc.float64s(p.Values)
+		case BinaryPoint:
+			enc.uint64s(p)
+		case []uint64:
+			enc.uint64s(p)
+		default:
+			enc.fail(fmt.Errorf("%w: point type %T", errors.ErrUnsupported, p))
+		}
+	}
+}
+
+// decodePoints reads the stored points written by encodePoints.
+func decodePoints[P any, K ID](dec *decoder) map[K]P {
+	if !dec.bool() {
+		return nil
+	}
+	n := dec.length()
+	points := make(map[K]P, min(n, maxChunk))
+	for i := 0; i < n && dec.err == nil; i++ {
+		id := decodeID[K](dec)
+		var point P
+		switch p := any(&point).(type) {
+		case *Point:
+			*p = dec.float64s()
+		case *Point32:
+			*p = dec.float32s()
+		case *SparsePoint:
+			p.Indices = dec.ints()
+			p.Values = dec.float64s()
+			if dec.err == nil && len(p.Indices) != len(p.Values) {
+				dec.fail("%d indices but %d values", len(p.Indices), len(p.Values))
+			}
+		case *BinaryPoint:
+			*p = dec.uint64s()
+		case *[]uint64:
+			*p = dec.uint64s()
+		default:
+			dec.fail("unsupported point type %T", point)
+		}
+		points[id] = point
+	}
+	return points
+}
+
+// indexKeys rebuilds the keys of each id in all l tables from the
+// occurrences of the ids in each table, which are visited by calling
+// each with the table index. The j-th occurrences of an id in all
+// tables are paired as its j-th insert, and the keys of width elements
+// are stored flat, table by table for each insert.
+func indexKeys[K ID, T any](dec *decoder, l, width int, each func(i int, add func(id K, key []T))) map[K][]T {
+	keys := make(map[K][]T)
+	for i := 0; i < l && dec.err == nil; i++ {
+		seen := make(map[K]int)
+		each(i, func(id K, key []T) {
+			if len(key) != width {
+				dec.fail("key of %d elements for id %v, expected %d", len(key), id, width)
+				return
+			}
+			j := seen[id]
+			seen[id]++
+			if j == len(keys[id])/(l*width) {
+				if i > 0 {
+					dec.fail("id %v missing from table 0", id)
+					return
+				}
+				keys[id] = append(keys[id], make([]T, l*width)...)
+			}
+			copy(keys[id][(j*l+i)*width:], key)
+		})
+		for id, inserts := range keys {
+			if n := len(inserts) / (l * width); dec.err == nil && seen[id] != n {
+				dec.fail("id %v found %d times in table %d, expected %d", id, seen[id], i, n)
+			}
+		}
+	}
+	return keys
+}
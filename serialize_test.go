@@ -0,0 +1,258 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// sortedQuery returns the sorted ids returned by query for each point.
+func sortedQuery[P any, K ID](points []P, query func(P) []K) [][]K {
+	results := make([][]K, len(points))
+	for i, p := range points {
+		results[i] = query(p)
+		slices.Sort(results[i])
+	}
+	return results
+}
+
+func Test_BasicLshWriteTo(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	lsh := NewBasicLsh(20, 5, 3, 10.0, WithVectors(), WithDuplicatePolicy(RejectDuplicates))
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	n, err := lsh.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo fail: %d bytes, %v", n, err)
+	}
+	var loaded BasicLsh
+	if n, err := loaded.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil || n != int64(buf.Len()) {
+		t.Fatalf("ReadFrom fail: %d bytes, %v", n, err)
+	}
+	if !reflect.DeepEqual(sortedQuery(points, lsh.Query), sortedQuery(points, loaded.Query)) {
+		t.Error("Loaded index should return the same candidates")
+	}
+	if !reflect.DeepEqual(lsh.QueryKNN(points[0], 5), loaded.QueryKNN(points[0], 5)) {
+		t.Error("Loaded index should keep the stored vectors")
+	}
+	if !reflect.DeepEqual(lsh.keys, loaded.keys) {
+		t.Error("Loaded index should rebuild the reverse index")
+	}
+	if err := loaded.TryInsert(points[0], "0"); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Loaded index should keep the duplicate policy, got %v", err)
+	}
+	// Writing is deterministic.
+	var again bytes.Buffer
+	loaded.WriteTo(&again)
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Error("Writing the loaded index should give the same bytes")
+	}
+}
+
+func Test_LshForestWriteTo(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	lsh := NewLshForest(20, 5, 3, 10.0)
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	lsh.Insert(points[0], "0")
+	var buf bytes.Buffer
+	if _, err := lsh.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var loaded LshForest
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := range lsh.trees {
+		if lsh.trees[i].count != loaded.trees[i].count || !reflect.DeepEqual(lsh.trees[i].root, loaded.trees[i].root) {
+			t.Errorf("Tree %d differs from the written tree", i)
+		}
+	}
+	if !reflect.DeepEqual(lsh.keys, loaded.keys) {
+		t.Error("Loaded index should rebuild the reverse index")
+	}
+	for i := range points {
+		if err := loaded.Remove(strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range loaded.trees {
+		if loaded.trees[i].count != 0 {
+			t.Errorf("Tree %d not empty after removing all ids", i)
+		}
+	}
+}
+
+func Test_MultiprobeLshWriteTo(t *testing.T) {
+	points := randomPoints(100, 20, 10.0)
+	lsh := NewMultiprobeLsh(20, 5, 3, 10.0, 8, WithSeed(42))
+	for i, p := range points {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	if _, err := lsh.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var loaded MultiprobeLsh
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lsh.perturbVecs, loaded.perturbVecs) {
+		t.Error("Loaded index should keep the probe sequence")
+	}
+	if !reflect.DeepEqual(sortedQuery(points, lsh.Query), sortedQuery(points, loaded.Query)) {
+		t.Error("Loaded index should return the same candidates")
+	}
+
+	// t exceeds the 3^3-1 valid perturbation sets.
+	lsh.t = 27
+	buf.Reset()
+	if _, err := lsh.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.ReadFrom(&buf); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("ReadFrom accepted t = 27 for m = 3: %v", err)
+	}
+}
+
+func Test_MultiprobeBitFamilyWriteTo(t *testing.T) {
+	// t exceeds the 2^3-1 sets of bits to flip.
+	for name, lsh := range map[string]interface {
+		WriteTo(w io.Writer) (int64, error)
+		ReadFrom(r io.Reader) (int64, error)
+	}{
+		"cosine":  NewMultiprobeLshWithFamily(NewCosineFamily(10, 2, 3), 10),
+		"hamming": NewMultiprobeLshWithFamily(NewHammingFamily(10, 2, 3), 10),
+	} {
+		var buf bytes.Buffer
+		if _, err := lsh.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := lsh.ReadFrom(&buf); err != nil {
+			t.Errorf("ReadFrom %s index fail: %v", name, err)
+		}
+	}
+}
+
+func Test_WriteToFamilies(t *testing.T) {
+	binaryPoints := randomBinaryPoints(50, 100)
+	hamming := NewMultiprobeLshWithFamily(NewHammingFamily(100, 5, 8), 4)
+	for i, p := range binaryPoints {
+		hamming.Insert(p, strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	if _, err := hamming.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loadedHamming := new(MultiprobeIndex[BinaryPoint])
+	if _, err := loadedHamming.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedQuery(binaryPoints, hamming.Query), sortedQuery(binaryPoints, loadedHamming.Query)) {
+		t.Error("Loaded Hamming index should return the same candidates")
+	}
+
+	sets := [][]uint64{rangeSet(0, 100), rangeSet(50, 150), rangeSet(1000, 1100)}
+	minhash := NewMinhashLsh(10, 4, WithVectors())
+	for i, set := range sets {
+		minhash.Insert(set, strconv.Itoa(i))
+	}
+	buf.Reset()
+	if _, err := minhash.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loadedMinhash := new(BasicIndex[[]uint64])
+	if _, err := loadedMinhash.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedQuery(sets, minhash.Query), sortedQuery(sets, loadedMinhash.Query)) {
+		t.Error("Loaded MinHash index should return the same candidates")
+	}
+
+	points32 := randomPointsOf[float32](50, 20, 10.0)
+	float32s := NewBasicLshWithFamily(NewL2FamilyOf[float32](20, 5, 3, 10.0), WithVectors())
+	for i, p := range points32 {
+		float32s.Insert(p, strconv.Itoa(i))
+	}
+	buf.Reset()
+	if _, err := float32s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := new(BasicLsh).ReadFrom(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for float64 points, got %v", err)
+	}
+	loadedFloat32s := new(BasicIndex[Point32])
+	if _, err := loadedFloat32s.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(float32s.family, loadedFloat32s.family) || !reflect.DeepEqual(float32s.points, loadedFloat32s.points) {
+		t.Error("Loaded float32 index should keep the family and the vectors")
+	}
+	if !reflect.DeepEqual(sortedQuery(points32, float32s.Query), sortedQuery(points32, loadedFloat32s.Query)) {
+		t.Error("Loaded float32 index should return the same candidates")
+	}
+
+	points := randomPoints(50, 20, 10.0)
+	mips := NewBasicLshWithFamily(NewMipsFamily(NewCosineFamily(21, 5, 4), 1))
+	for i, p := range points {
+		mips.Insert(p, strconv.Itoa(i))
+	}
+	buf.Reset()
+	if _, err := mips.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var loadedMips BasicLsh
+	if _, err := loadedMips.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedQuery(points, mips.Query), sortedQuery(points, loadedMips.Query)) {
+		t.Error("Loaded MIPS index should return the same candidates")
+	}
+	if loadedMips.family.(*mipsParams).maxNorm != mips.family.(*mipsParams).maxNorm {
+		t.Error("Loaded MIPS index should keep the max norm")
+	}
+}
+
+// customFamily is a family of hash functions outside the package.
+type customFamily struct {
+	HashFamily
+}
+
+func Test_ReadFromInvalid(t *testing.T) {
+	lsh := NewBasicLsh(20, 5, 3, 10.0)
+	for i, p := range randomPoints(10, 20, 10.0) {
+		lsh.Insert(p, strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	lsh.WriteTo(&buf)
+	data := buf.Bytes()
+
+	corrupt := slices.Clone(data)
+	corrupt[len(corrupt)/2] ^= 1
+	if _, err := new(BasicLsh).ReadFrom(bytes.NewReader(corrupt)); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for corrupt data, got %v", err)
+	}
+	if _, err := new(BasicLsh).ReadFrom(bytes.NewReader(data[:len(data)-10])); !errors.Is(err, io.ErrUnexpectedEOF) || !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for truncated data, got %v", err)
+	}
+	if _, err := new(LshForest).ReadFrom(bytes.NewReader(data)); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for another index type, got %v", err)
+	}
+	if _, err := new(BasicIndex[BinaryPoint]).ReadFrom(bytes.NewReader(data)); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for another point type, got %v", err)
+	}
+	if _, err := new(BasicIndexOf[Point, uint64]).ReadFrom(bytes.NewReader(data)); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for another id type, got %v", err)
+	}
+	custom := NewBasicLshWithFamily[Point](customFamily{NewL2Family(20, 5, 3, 10.0)})
+	if _, err := custom.WriteTo(io.Discard); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected errors.ErrUnsupported for a custom family, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package lsh
+
+import (
+	"math/rand"
+)
+
+// simhashParams is the family of random hyperplane LSH functions
+// (SimHash) by Moses Charikar for cosine distance. Each hash value
+// is a single bit: the sign of the projection a·x. The inputs are
+// vectors of F.
+type simhashParams[F Float] struct {
+	// Dimensionality of the input data.
+	dim int
+	// Number of hash tables.
+	l int
+	// Number of hash functions for each table.
+	m int
+
+	// Normal vectors of the random hyperplanes for each (l, m).
+	a [][]Vector[F]
+	// Contiguous l*m x dim matrix holding the vectors of a.
+	matrix []F
+}
+
+// NewCosineFamily creates the family of random hyperplane LSH
+// functions for cosine distance. Every hash value is a bit, so
+// the keys of the hash tables are m-bit signatures.
+// dim is the diminsionality of the data, l is the number of hash
+// tables to use, m is the number of hash values to concatenate to
+// form the key to the hash tables.
+func NewCosineFamily(dim, l, m int, opts ...Option) HashFamily {
+	return NewCosineFamilyOf[float64](dim, l, m, opts...)
+}
+
+// NewCosineFamilyOf creates the family of random hyperplane LSH
+// functions for cosine distance over vectors of F, such as Point32 for
+// float32. The parameters are the same as NewCosineFamily.
+func NewCosineFamilyOf[F Float](dim, l, m int, opts ...Option) Family[Vector[F]] {
+	return newSimhashParams[F](dim, l, m, newConfig(opts).rand())
+}
+
+func newSimhashParams[F Float](dim, l, m int, random *rand.Rand) *simhashParams[F] {
+	a := make([][]Vector[F], l)
+	for i := range a {
+		a[i] = make([]Vector[F], m)
+		for j := range a[i] {
+			a[i][j] = make(Vector[F], dim)
+			for d := 0; d < dim; d++ {
+				a[i][j][d] = F(random.NormFloat64())
+			}
+		}
+	}
+	return &simhashParams[F]{
+		dim:    dim,
+		l:      l,
+		m:      m,
+		a:      a,
+		matrix: packVectors(a, dim),
+	}
+}
+
+func (sh *simhashParams[F]) Dim() int       { return sh.dim }
+func (sh *simhashParams[F]) NumTables() int { return sh.l }
+func (sh *simhashParams[F]) NumHashes() int { return sh.m }
+func (sh *simhashParams[F]) bitHashes()     {}
+
+// Distance returns the cosine distance between p and q.
+func (sh *simhashParams[F]) Distance(p, q Vector[F]) float64 { return p.Cosine(q) }
+
+// Hash returns the m-bit signature for the i-th hash table.
+func (sh *simhashParams[F]) Hash(point Vector[F], i int) []int {
+	s := make(hashTableKey, sh.m)
+	for j := 0; j < sh.m; j++ {
+		if point.Dot(sh.a[i][j]) >= 0 {
+			s[j] = 1
+		}
+	}
+	return s
+}
+
+// HashBatch returns the m-bit signatures of all the points for all the
+// hash tables, computing the projections as a blocked matrix
+// multiplication.
+func (sh *simhashParams[F]) HashBatch(points []Vector[F]) [][][]int {
+	return hashBatch(sh.matrix, sh.dim, sh.l, sh.m, points, func(proj float64, i, j int) int {
+		if proj >= 0 {
+			return 1
+		}
+		return 0
+	})
+}
@@ -0,0 +1,106 @@
+package lsh
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func Test_Cosine(t *testing.T) {
+	p := Point{1, 0}
+	if d := p.Cosine(Point{2, 0}); math.Abs(d) > 1e-12 {
+		t.Errorf("Cosine of parallel points should be 0, got %v", d)
+	}
+	if d := p.Cosine(Point{0, 3}); math.Abs(d-1) > 1e-12 {
+		t.Errorf("Cosine of orthogonal points should be 1, got %v", d)
+	}
+	if d := p.Cosine(Point{-1, 0}); math.Abs(d-2) > 1e-12 {
+		t.Errorf("Cosine of opposite points should be 2, got %v", d)
+	}
+	if d := p.Cosine(Point{0, 0}); d != 1 {
+		t.Errorf("Cosine to zero vector should be 1, got %v", d)
+	}
+}
+
+func Test_CosineFamily(t *testing.T) {
+	family := NewCosineFamily(100, 5, 8)
+	for _, p := range randomPoints(10, 100, 32.0) {
+		scaled := make(Point, len(p))
+		for d := range p {
+			scaled[d] = p[d] * 3
+		}
+		for i := 0; i < family.NumTables(); i++ {
+			key, scaledKey := family.Hash(p, i), family.Hash(scaled, i)
+			for j, h := range key {
+				if h != 0 && h != 1 {
+					t.Errorf("Hash value should be a bit, got %v", h)
+				}
+				if h != scaledKey[j] {
+					t.Error("Hash should not depend on the norm")
+				}
+			}
+		}
+	}
+}
+
+func Test_CosineQuery(t *testing.T) {
+	points := randomPoints(10, 100, 32.0)
+	basic := NewBasicLshWithFamily(NewCosineFamily(100, 5, 8))
+	forest := NewLshForestWithFamily(NewCosineFamily(100, 5, 8))
+	multiprobe := NewMultiprobeLshWithFamily(NewCosineFamily(100, 5, 8), 10)
+	for i, p := range points {
+		basic.Insert(p, strconv.Itoa(i))
+		forest.Insert(p, strconv.Itoa(i))
+		multiprobe.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		key := strconv.Itoa(i)
+		if !contains(basic.Query(p), key) {
+			t.Error("BasicLsh query fail")
+		}
+		if !contains(forest.Query(p, 5), key) {
+			t.Error("LshForest query fail")
+		}
+		if !contains(multiprobe.Query(p), key) {
+			t.Error("MultiprobeLsh query fail")
+		}
+	}
+}
+
+func Test_MultiprobeFlipSets(t *testing.T) {
+	lsh := NewMultiprobeLshWithFamily(NewCosineFamily(10, 2, 5), 12)
+	if len(lsh.perturbSets) != 12 {
+		t.Fatalf("Expected 12 perturbation sets, found %d", len(lsh.perturbSets))
+	}
+	for i, ps := range lsh.perturbSets {
+		radius := 1
+		if i >= 5 {
+			radius = 2
+		}
+		if len(ps) != radius {
+			t.Errorf("Set %d should flip %d bits: %v", i, radius, ps)
+		}
+	}
+	base := []hashTableKey{{0, 1, 0, 1, 1}, {1, 1, 1, 0, 0}}
+	for _, vecs := range lsh.perturbVecs {
+		for i, key := range lsh.perturb(base, vecs) {
+			flipped := 0
+			for j, h := range key {
+				if h != 0 && h != 1 {
+					t.Fatalf("Perturbed hash value should be a bit, got %v", h)
+				}
+				if h != base[i][j] {
+					flipped++
+				}
+			}
+			if flipped == 0 {
+				t.Error("Perturbation should flip at least one bit")
+			}
+		}
+	}
+	// t is capped at the 2^m-1 flip sets.
+	lsh = NewMultiprobeLshWithFamily(NewCosineFamily(10, 2, 3), 100)
+	if len(lsh.perturbSets) != 7 || lsh.t != 7 {
+		t.Errorf("Expected t = 7 perturbation sets, found %d sets and t = %d", len(lsh.perturbSets), lsh.t)
+	}
+}
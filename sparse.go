@@ -0,0 +1,239 @@
+package lsh
+
+import (
+	"math"
+)
+
+// SparsePoint is a vector in the L2 metric space given by its
+// non-zero elements, for high dimensional data with few non-zeros
+// such as TF-IDF features.
+// The indices must be increasing and less than the dimensionality of
+// the family, and there must be as many values as indices. TryInsert
+// and TryQuery return an error wrapping ErrDimensionMismatch for
+// indices out of range, and ErrInvalidPoint for other malformed points.
+type SparsePoint struct {
+	// Indices of the non-zero elements, in increasing order.
+	Indices []int
+	// Values of the non-zero elements.
+	Values []float64
+}
+
+// merge calls f with the values of p and q at every index where
+// either is non-zero.
+func (p SparsePoint) merge(q SparsePoint, f func(x, y float64)) {
+	i, j := 0, 0
+	for i < len(p.Indices) || j < len(q.Indices) {
+		switch {
+		case j == len(q.Indices) || i < len(p.Indices) && p.Indices[i] < q.Indices[j]:
+			f(p.Values[i], 0)
+			i++
+		case i == len(p.Indices) || q.Indices[j] < p.Indices[i]:
+			f(0, q.Values[j])
+			j++
+		default:
+			f(p.Values[i], q.Values[j])
+			i++
+			j++
+		}
+	}
+}
+
+// Dot returns the dot product of two points.
+func (p SparsePoint) Dot(q SparsePoint) float64 {
+	s := 0.0
+	i, j := 0, 0
+	for i < len(p.Indices) && j < len(q.Indices) {
+		switch {
+		case p.Indices[i] < q.Indices[j]:
+			i++
+		case q.Indices[j] < p.Indices[i]:
+			j++
+		default:
+			s += p.Values[i] * q.Values[j]
+			i++
+			j++
+		}
+	}
+	return s
+}
+
+// L2 returns the L2 distance of two points.
+func (p SparsePoint) L2(q SparsePoint) float64 {
+	s := 0.0
+	p.merge(q, func(x, y float64) {
+		s += (x - y) * (x - y)
+	})
+	return math.Sqrt(s)
+}
+
+// L1 returns the L1 distance of two points.
+func (p SparsePoint) L1(q SparsePoint) float64 {
+	s := 0.0
+	p.merge(q, func(x, y float64) {
+		s += math.Abs(x - y)
+	})
+	return s
+}
+
+// Cosine returns the cosine distance of two points, that is,
+// 1 minus the cosine of the angle between them.
+// The distance to a zero vector is 1.
+func (p SparsePoint) Cosine(q SparsePoint) float64 {
+	pp, qq := p.Dot(p), q.Dot(q)
+	if pp == 0 || qq == 0 {
+		return 1
+	}
+	return 1 - p.Dot(q)/math.Sqrt(pp*qq)
+}
+
+// sparseProjections are the random projection vectors of the sparse
+// families, whose elements are computed when needed from a hash of
+// the seed, the function and the dimension instead of being stored.
+type sparseProjections struct {
+	// Seed of the projection vectors.
+	seed uint64
+	// Metric selecting the p-stable distribution of the elements.
+	metric Metric
+}
+
+// project returns the dot product of point with the projection vector
+// of the j-th function of the i-th table, where m is the number of
+// functions per table.
+func (sp sparseProjections) project(point SparsePoint, i, j, m int) float64 {
+	row := permute(uint64(i*m+j), sp.seed)
+	s := 0.0
+	for k, d := range point.Indices {
+		s += point.Values[k] * sp.element(permute(uint64(d), row))
+	}
+	return s
+}
+
+// element returns the projection vector element for the hash h,
+// drawn from the Cauchy distribution for L1 and from the standard
+// normal distribution otherwise.
+func (sp sparseProjections) element(h uint64) float64 {
+	// A uniform value in (0, 1) from the top 53 bits.
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	if sp.metric == L1 {
+		return math.Tan(math.Pi * (u - 0.5))
+	}
+	// Box-Muller transform with a second uniform value.
+	v := float64(permute(h, 0x9e3779b97f4a7c15)>>11) / (1 << 53)
+	return math.Sqrt(-2*math.Log(u)) * math.Cos(2*math.Pi*v)
+}
+
+// sparseLshParams is the family of p-stable LSH functions for L2 or
+// L1 distance between SparsePoints, h(x) = floor((a·x + b) / w), with
+// the projection vectors a computed from their seed.
+type sparseLshParams struct {
+	sparseProjections
+	// Dimensionality of the input data.
+	dim int
+	// Number of hash tables.
+	l int
+	// Number of hash functions for each table.
+	m int
+	// Shared constant for each table.
+	w float64
+	// Offsets for each (l, m).
+	b [][]float64
+}
+
+// NewSparseFamily creates the family of p-stable LSH functions for L2
+// distance between SparsePoints, or L1 with WithMetric. Its memory
+// does not depend on dim, and hashing a point takes time proportional
+// to its number of non-zeros. The parameters are the same as
+// NewL2Family.
+func NewSparseFamily(dim, l, m int, w float64, opts ...Option) Family[SparsePoint] {
+	cfg := newConfig(opts)
+	random := cfg.rand()
+	f := &sparseLshParams{
+		sparseProjections: sparseProjections{
+			seed:   random.Uint64(),
+			metric: cfg.metric,
+		},
+		dim: dim,
+		l:   l,
+		m:   m,
+		w:   w,
+		b:   make([][]float64, l),
+	}
+	for i := range f.b {
+		f.b[i] = make([]float64, m)
+		for j := range f.b[i] {
+			f.b[i][j] = random.Float64() * w
+		}
+	}
+	return f
+}
+
+func (sl *sparseLshParams) Dim() int       { return sl.dim }
+func (sl *sparseLshParams) NumTables() int { return sl.l }
+func (sl *sparseLshParams) NumHashes() int { return sl.m }
+
+// Distance returns the L2 or L1 distance between p and q.
+func (sl *sparseLshParams) Distance(p, q SparsePoint) float64 {
+	if sl.metric == L1 {
+		return p.L1(q)
+	}
+	return p.L2(q)
+}
+
+// Hash returns the combined hash value for the i-th hash table.
+func (sl *sparseLshParams) Hash(point SparsePoint, i int) []int {
+	s := make(hashTableKey, sl.m)
+	for j := range s {
+		hv := (sl.project(point, i, j, sl.m) + sl.b[i][j]) / sl.w
+		s[j] = int(math.Floor(hv))
+	}
+	return s
+}
+
+// sparseSimhashParams is the family of random hyperplane LSH
+// functions for cosine distance between SparsePoints, with the normal
+// vectors of the hyperplanes computed from their seed.
+type sparseSimhashParams struct {
+	sparseProjections
+	// Dimensionality of the input data.
+	dim int
+	// Number of hash tables.
+	l int
+	// Number of hash functions for each table.
+	m int
+}
+
+// NewSparseCosineFamily creates the family of random hyperplane LSH
+// functions for cosine distance between SparsePoints. Its memory does
+// not depend on dim, and hashing a point takes time proportional to
+// its number of non-zeros. The parameters are the same as
+// NewCosineFamily.
+func NewSparseCosineFamily(dim, l, m int, opts ...Option) Family[SparsePoint] {
+	return &sparseSimhashParams{
+		sparseProjections: sparseProjections{
+			seed:   newConfig(opts).rand().Uint64(),
+			metric: L2,
+		},
+		dim: dim,
+		l:   l,
+		m:   m,
+	}
+}
+
+func (ss *sparseSimhashParams) Dim() int       { return ss.dim }
+func (ss *sparseSimhashParams) NumTables() int { return ss.l }
+func (ss *sparseSimhashParams) NumHashes() int { return ss.m }
+func (ss *sparseSimhashParams) bitHashes()     {}
+
+// Distance returns the cosine distance between p and q.
+func (ss *sparseSimhashParams) Distance(p, q SparsePoint) float64 { return p.Cosine(q) }
+
+// Hash returns the m-bit signature for the i-th hash table.
+func (ss *sparseSimhashParams) Hash(point SparsePoint, i int) []int {
+	s := make(hashTableKey, ss.m)
+	for j := range s {
+		if ss.project(point, i, j, ss.m) >= 0 {
+			s[j] = 1
+		}
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// randomSparsePoints returns n points of dimension dim with nnz
+// non-zeros each.
+func randomSparsePoints(n, dim, nnz int) []SparsePoint {
+	random := rand.New(rand.NewSource(1))
+	points := make([]SparsePoint, n)
+	for i := range points {
+		seen := make(map[int]bool)
+		for len(seen) < nnz {
+			d := random.Intn(dim)
+			if !seen[d] {
+				seen[d] = true
+				points[i].Indices = append(points[i].Indices, d)
+			}
+		}
+		slices.Sort(points[i].Indices)
+		points[i].Values = make([]float64, nnz)
+		for j := range points[i].Values {
+			points[i].Values[j] = random.Float64()
+		}
+	}
+	return points
+}
+
+// dense returns the dense vector of p.
+func (p SparsePoint) dense(dim int) Point {
+	v := make(Point, dim)
+	for i, d := range p.Indices {
+		v[d] = p.Values[i]
+	}
+	return v
+}
+
+func Test_SparsePoint(t *testing.T) {
+	points := randomSparsePoints(20, 50, 10)
+	points = append(points, SparsePoint{})
+	for _, p := range points {
+		for _, q := range points {
+			pd, qd := p.dense(50), q.dense(50)
+			for name, d := range map[string][2]float64{
+				"Dot":    {p.Dot(q), pd.Dot(qd)},
+				"L2":     {p.L2(q), pd.L2(qd)},
+				"L1":     {p.L1(q), pd.L1(qd)},
+				"Cosine": {p.Cosine(q), pd.Cosine(qd)},
+			} {
+				if math.Abs(d[0]-d[1]) > 1e-12 {
+					t.Errorf("%s of sparse points is %v, expected %v", name, d[0], d[1])
+				}
+			}
+		}
+	}
+}
+
+func Test_SparseProjections(t *testing.T) {
+	for _, metric := range []Metric{L2, L1} {
+		sp := sparseProjections{seed: 42, metric: metric}
+		point := SparsePoint{Indices: []int{0}, Values: []float64{1}}
+		abs := make([]float64, 100000)
+		for i := range abs {
+			abs[i] = math.Abs(sp.project(point, i, 0, 1))
+		}
+		slices.Sort(abs)
+		// The median absolute value is 0.6745 for the standard normal
+		// distribution and 1 for the standard Cauchy distribution.
+		expected := 0.6745
+		if metric == L1 {
+			expected = 1
+		}
+		if median := abs[len(abs)/2]; math.Abs(median-expected) > 0.02 {
+			t.Errorf("Median absolute projection element is %v for metric %d, expected %v", median, metric, expected)
+		}
+	}
+}
+
+func Test_SparseFamily(t *testing.T) {
+	dim := 1000000
+	points := randomSparsePoints(100, dim, 100)
+	basic := NewBasicLshWithFamily(NewSparseFamily(dim, 10, 4, 1.0), WithVectors())
+	multiprobe := NewMultiprobeLshWithFamily(NewSparseCosineFamily(dim, 5, 8), 4)
+	for i, p := range points {
+		basic.Insert(p, strconv.Itoa(i))
+		multiprobe.Insert(p, strconv.Itoa(i))
+	}
+	for i, p := range points {
+		key := strconv.Itoa(i)
+		// A near point differs by a small amount in one value.
+		near := SparsePoint{Indices: p.Indices, Values: append([]float64(nil), p.Values...)}
+		near.Values[0] += 0.01
+		if !contains(basic.Query(near), key) || !contains(multiprobe.Query(near), key) {
+			t.Errorf("Query of a point near point %d fails to return it", i)
+		}
+		if neighbors := basic.QueryKNN(p, 1); neighbors[0].ID != key || neighbors[0].Distance != 0 {
+			t.Errorf("QueryKNN of point %d returns %v", i, neighbors)
+		}
+	}
+	invalid := map[error]SparsePoint{
+		ErrDimensionMismatch: {Indices: []int{dim}, Values: []float64{1}},
+		ErrInvalidPoint:      {Indices: []int{2, 1}, Values: []float64{1, 1}},
+	}
+	for expected, p := range invalid {
+		if err := basic.TryInsert(p, "invalid"); !errors.Is(err, expected) {
+			t.Errorf("Expected %v, got %v", expected, err)
+		}
+	}
+	if _, err := basic.TryQuery(SparsePoint{Indices: []int{1}}); !errors.Is(err, ErrInvalidPoint) {
+		t.Errorf("Expected ErrInvalidPoint, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := basic.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(BasicIndex[SparsePoint])
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(basic.family, loaded.family) || !reflect.DeepEqual(basic.points, loaded.points) {
+		t.Error("Loaded index should keep the family and the vectors")
+	}
+	buf.Reset()
+	if _, err := multiprobe.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loadedMultiprobe := new(MultiprobeIndex[SparsePoint])
+	if _, err := loadedMultiprobe.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sortedQuery(points, multiprobe.Query), sortedQuery(points, loadedMultiprobe.Query)) {
+		t.Error("Loaded index should return the same candidates")
+	}
+}
+
+func Benchmark_SparseHash(b *testing.B) {
+	point := randomSparsePoints(1, 1000000, 100)[0]
+	family := NewSparseFamily(1000000, 10, 10, 1.0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		hashKeys(family, point)
+	}
+}
@@ -0,0 +1,240 @@
+package lsh
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrRecallNotReached is the error returned by Tune when no set of
+// parameters reaches the target recall.
+var ErrRecallNotReached = errors.New("lsh: target recall not reached")
+
+// TuneSpace is the set of parameters searched by Tune. A nil field
+// uses the default values.
+type TuneSpace struct {
+	// L are the numbers of hash tables, by default 1, 2, 4, 8, 16
+	// and 32.
+	L []int
+	// M are the numbers of hash values per key, by default 2, 4, 6,
+	// 8, 10 and 12.
+	M []int
+	// W are the slot sizes, by default 1, 2, 4 and 8 times the median
+	// distance from a sample query to its k-th nearest neighbour.
+	W []float64
+	// T are the numbers of perturbation vectors of Multi-probe LSH,
+	// where 0 is the basic LSH, by default 0, 4 and 16.
+	T []int
+}
+
+// TuneResult is the evaluation of one set of parameters on the sample
+// queries.
+type TuneResult struct {
+	// Params are the evaluated parameters.
+	Params Params
+	// Recall is the mean fraction of the k nearest neighbours of a
+	// sample query found among its candidates.
+	Recall float64
+	// Candidates is the mean number of candidates of a sample query.
+	Candidates float64
+	// Cost is the estimated query cost in operations on vectors: the
+	// L*M hash projections plus one distance per candidate.
+	Cost float64
+	// Memory is the estimated memory of the index holding the sample
+	// data with int ids, in bytes, excluding the stored vectors.
+	Memory int64
+}
+
+// Tune searches the parameters of the space for the one with the
+// lowest query cost whose recall of the k nearest neighbours of the
+// sample queries in the sample data is at least recall, measured
+// against a brute-force search. The options are applied to every
+// evaluated index, for example WithMetric(L1).
+// It returns the chosen parameters and all evaluated parameters, in
+// the order of evaluation. Once a number of tables reaches the target,
+// larger numbers of tables with the same m, w and t are not evaluated,
+// nor are values of t exceeding the 3^m-1 perturbation sets.
+// It returns an error wrapping ErrInvalidParams or
+// ErrDimensionMismatch for invalid inputs, and ErrRecallNotReached
+// with the evaluated parameters if none reaches the target.
+func Tune(data, queries []Point, k int, recall float64, space TuneSpace, opts ...Option) (TuneResult, []TuneResult, error) {
+	switch {
+	case len(data) == 0 || len(queries) == 0:
+		return TuneResult{}, nil, fmt.Errorf("%w: no sample data or queries", ErrInvalidParams)
+	case k <= 0 || k > len(data):
+		return TuneResult{}, nil, fmt.Errorf("%w: k must be in [1, %d], got %d", ErrInvalidParams, len(data), k)
+	case !(recall > 0 && recall <= 1):
+		return TuneResult{}, nil, fmt.Errorf("%w: recall must be in (0, 1], got %v", ErrInvalidParams, recall)
+	}
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return TuneResult{}, nil, err
+	}
+	dim := len(data[0])
+	for _, points := range [][]Point{data, queries} {
+		for i, p := range points {
+			if len(p) != dim {
+				return TuneResult{}, nil, fmt.Errorf("%w: point %d: expected %d, got %d", ErrDimensionMismatch, i, dim, len(p))
+			}
+		}
+	}
+	distance := Point.L2
+	if cfg.metric == L1 {
+		distance = Point.L1
+	}
+	// The distance to the k-th nearest neighbour of each query.
+	radii := make([]float64, len(queries))
+	dists := make([]float64, len(data))
+	for i, q := range queries {
+		for j, p := range data {
+			dists[j] = distance(p, q)
+		}
+		slices.Sort(dists)
+		radii[i] = dists[k-1]
+	}
+	space = space.withDefaults(radii)
+
+	var results []TuneResult
+	best := -1
+	for _, t := range space.T {
+		for _, m := range space.M {
+			for _, w := range space.W {
+				for _, l := range space.L {
+					if t > numPerturbSets(m) {
+						break
+					}
+					params := Params{Dim: dim, L: l, M: m, W: w, T: t}
+					if err := params.Validate(); err != nil {
+						return TuneResult{}, nil, err
+					}
+					result, err := evaluateParams(params, data, queries, k, radii, distance, opts)
+					if err != nil {
+						return TuneResult{}, nil, err
+					}
+					results = append(results, result)
+					if result.Recall < recall {
+						continue
+					}
+					if best < 0 || cmp.Or(cmp.Compare(result.Cost, results[best].Cost),
+						cmp.Compare(result.Memory, results[best].Memory)) < 0 {
+						best = len(results) - 1
+					}
+					break
+				}
+			}
+		}
+	}
+	if best < 0 {
+		return TuneResult{}, results, fmt.Errorf("%w: %v at k=%d", ErrRecallNotReached, recall, k)
+	}
+	return results[best], results, nil
+}
+
+// withDefaults returns the space with the default values of the nil
+// fields, given the distances of the sample queries to their k-th
+// nearest neighbours.
+func (space TuneSpace) withDefaults(radii []float64) TuneSpace {
+	if space.L == nil {
+		space.L = []int{1, 2, 4, 8, 16, 32}
+	}
+	if space.M == nil {
+		space.M = []int{2, 4, 6, 8, 10, 12}
+	}
+	if space.W == nil {
+		r := slices.Sorted(slices.Values(radii))[len(radii)/2]
+		if r == 0 {
+			r = 1
+		}
+		space.W = []float64{r, 2 * r, 4 * r, 8 * r}
+	}
+	if space.T == nil {
+		space.T = []int{0, 4, 16}
+	}
+	return space
+}
+
+// evaluateParams builds an index with params on the sample data and
+// measures it on the sample queries, whose k-th nearest neighbours are
+// at the distances radii.
+func evaluateParams(params Params, data, queries []Point, k int, radii []float64,
+	distance func(Point, Point) float64, opts []Option) (TuneResult, error) {
+	family, err := newLshParamsFromParams(params, opts)
+	if err != nil {
+		return TuneResult{}, err
+	}
+	basic := NewBasicIndexOf[int](family, opts...)
+	var index interface {
+		InsertBatch(points []Point, ids []int) error
+		QueryBatch(queries []Point) ([][]int, error)
+	} = basic
+	if params.T > 0 {
+		multiprobe := &MultiprobeIndexOf[Point, int]{
+			BasicIndexOf: basic,
+			t:            params.T,
+		}
+		if err := multiprobe.initProbeSequence(newConfig(opts)); err != nil {
+			return TuneResult{}, err
+		}
+		index = multiprobe
+	}
+	ids := make([]int, len(data))
+	for i := range ids {
+		ids[i] = i
+	}
+	if err := index.InsertBatch(data, ids); err != nil {
+		return TuneResult{}, err
+	}
+	candidates, err := index.QueryBatch(queries)
+	if err != nil {
+		return TuneResult{}, err
+	}
+	result := TuneResult{Params: params}
+	for i, q := range queries {
+		// Count the candidates within the distance of the k-th nearest
+		// neighbour, so that ties at that distance are not missed.
+		found := 0
+		for _, id := range candidates[i] {
+			if distance(data[id], q) <= radii[i] {
+				found++
+			}
+		}
+		result.Recall += float64(min(found, k)) / float64(k)
+		result.Candidates += float64(len(candidates[i]))
+	}
+	result.Recall /= float64(len(queries))
+	result.Candidates /= float64(len(queries))
+	result.Cost = float64(params.L*params.M) + result.Candidates
+	result.Memory = basic.memory() + int64(params.T*params.L*(sliceSize+8*params.M))
+	return result, nil
+}
+
+// Approximate sizes in bytes of the parts of an index on 64-bit
+// platforms, used to estimate its memory.
+const (
+	sliceSize = 24
+	// Size of a map entry with its share of the unused slots.
+	mapEntrySize = 32
+)
+
+// memory estimates the memory of the hash tables and the keys of the
+// ids, in bytes.
+func (index *BasicIndexOf[P, K]) memory() int64 {
+	var id K
+	idSize := 8
+	if _, ok := any(id).(string); ok {
+		idSize = 16
+	}
+	size := 0
+	for _, table := range index.tables {
+		for _, entry := range table {
+			for ; entry != nil; entry = entry.next {
+				size += mapEntrySize + 2*sliceSize + 8 + 8*len(entry.key) + idSize*cap(entry.ids)
+			}
+		}
+	}
+	for _, fps := range index.keys {
+		size += mapEntrySize + sliceSize + 8*cap(fps)
+	}
+	return int64(size)
+}
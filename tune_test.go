@@ -0,0 +1,63 @@
+package lsh
+
+import (
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func Test_Tune(t *testing.T) {
+	data := randomPoints(500, 20, 10.0)
+	random := rand.New(rand.NewSource(2))
+	queries := make([]Point, 20)
+	for i := range queries {
+		queries[i] = make(Point, 20)
+		for d := range queries[i] {
+			queries[i][d] = data[i][d] + random.NormFloat64()
+		}
+	}
+	best, results, err := Tune(data, queries, 5, 0.9, TuneSpace{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.Recall < 0.9 {
+		t.Errorf("Expected recall at least 0.9, got %v", best.Recall)
+	}
+	if !slices.ContainsFunc(results, func(result TuneResult) bool { return result.Params.T > 0 }) {
+		t.Error("Multi-probe LSH should be searched by default")
+	}
+	for _, result := range results {
+		if result.Memory <= 0 || result.Cost < float64(result.Params.L*result.Params.M) {
+			t.Errorf("Invalid estimates %+v", result)
+		}
+		if result.Recall >= 0.9 && result.Cost < best.Cost {
+			t.Errorf("%+v is cheaper than %+v", result, best)
+		}
+	}
+	// Index with the tuned parameters.
+	if _, err := NewBasicLshFromParams(best.Params); err != nil {
+		t.Error(err)
+	}
+
+	_, results, err = Tune(data, queries, 5, 0.9, TuneSpace{L: []int{4}, M: []int{1, 4}, T: []int{4}})
+	if err != nil && !errors.Is(err, ErrRecallNotReached) {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Params.M == 1 {
+			t.Errorf("t=4 exceeds the perturbation sets of m=1, evaluated %+v", result)
+		}
+	}
+
+	_, results, err = Tune(data, queries, 5, 1, TuneSpace{L: []int{1}, M: []int{12}, W: []float64{0.01}, T: []int{0}})
+	if !errors.Is(err, ErrRecallNotReached) || len(results) != 1 {
+		t.Errorf("Expected ErrRecallNotReached with 1 result, got %v, %d", err, len(results))
+	}
+	if _, _, err := Tune(data, queries, 0, 0.9, TuneSpace{}); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("Expected ErrInvalidParams, got %v", err)
+	}
+	if _, _, err := Tune(data, []Point{{1}}, 5, 0.9, TuneSpace{}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}